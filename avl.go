@@ -1,18 +1,37 @@
 // Package avl implements a type-safe generic AVL balanced binary tree.
+//
+// A Tree is not safe for concurrent use. Even operations that
+// do not modify the Tree, such as Lookup, share internal
+// buffers for calling Compare, so all access to a Tree
+// must be serialized by the caller, for example with a
+// sync.Mutex. Because every Node points to its parent,
+// versions of a Tree cannot share nodes, so the package
+// does not offer persistent or path-copied snapshots.
 package avl
 
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"reflect"
+	"sort"
 )
 
 // A Node of the balanced tree.
+//
+// On 64-bit platforms a Node takes 80 bytes, 16 of them for
+// the value set by SetAux, whether or not SetAux is ever
+// called. Without aux a Node would fit in the 64-byte
+// allocation size class, so aux costs every Tree 16 bytes
+// per element.
 type Node struct {
-	val reflect.Value
-	c   [2]*Node
-	p   *Node
-	b   int8
+	val     reflect.Value
+	c       [2]*Node
+	p       *Node
+	size    int
+	b       int8
+	deleted bool
+	aux     interface{}
 }
 
 // Setter provides access to the underlying Tree data structure
@@ -29,6 +48,142 @@ type Tree struct {
 	elemType reflect.Type
 	size     int
 	cmp      func(a, b reflect.Value) int8
+
+	// min and max are the nodes holding the minimum and
+	// maximum elements, kept up to date as nodes are linked
+	// and unlinked so that Min and Max take O(1) time.
+	min, max *Node
+
+	// rebuildFrac and deleted implement the AutoRebuild policy.
+	rebuildFrac float64
+	deleted     int
+
+	multiset   bool
+	checkOrder bool
+
+	// memo, if not nil, implements the MemoizeCompare option.
+	memo     *cmpMemo
+	memoSize int
+
+	// cache, if not nil, implements the CacheLookups option.
+	// If dynamicKeys is set, an element may hold an interface
+	// value that cannot be hashed, so it is checked first.
+	cache       *lookupCache
+	cacheSize   int
+	dynamicKeys bool
+
+	// guard, if not nil, is called with every element
+	// passed to the functions provided by Make.
+	guard func(reflect.Value)
+
+	// onEvict and onReplace call the optional OnEvict
+	// and OnReplace methods of the tree struct.
+	onEvict   func(v reflect.Value)
+	onReplace func(old, new reflect.Value)
+
+	// onLookup calls the optional OnLookup method.
+	onLookup func(key reflect.Value, found bool)
+
+	// copy, if not nil, calls the Copy method of the tree
+	// struct to make the value that is stored for an element.
+	copy func(v reflect.Value) reflect.Value
+
+	// tracef, if not nil, records the steps of an insertion
+	// for TraceInsert.
+	tracef func(format string, args ...interface{})
+
+	// funcs holds the sorted names of the function
+	// fields that Make provided.
+	funcs []string
+}
+
+// An Option configures a Tree when it is created by Make.
+type Option func(*Tree)
+
+// AutoRebuild returns an Option that makes the Tree call
+// Rebuild automatically once the number of elements deleted
+// since the last rebuild exceeds frac times the current size
+// of the tree. For example, AutoRebuild(0.5) rebuilds the
+// tree after more than half as many elements as it now holds
+// have been deleted. This keeps long-lived, read-heavy trees at
+// minimal height at the amortized cost of the O(n) rebuild.
+// Trees are not rebuilt automatically unless this option
+// is given.
+func AutoRebuild(frac float64) Option {
+	return func(t *Tree) {
+		t.rebuildFrac = frac
+	}
+}
+
+// RejectNaN returns an Option that makes the functions
+// provided by Make panic when passed a floating-point or
+// complex NaN element. It has no effect on trees of other
+// element types. See Make for why NaN elements are a problem.
+func RejectNaN() Option {
+	return func(t *Tree) {
+		switch t.elemType.Kind() {
+		case reflect.Float32, reflect.Float64:
+			t.addGuard(func(v reflect.Value) {
+				if f := v.Float(); f != f {
+					panic("avl: NaN element")
+				}
+			})
+		case reflect.Complex64, reflect.Complex128:
+			t.addGuard(func(v reflect.Value) {
+				if c := v.Complex(); c != c {
+					panic("avl: NaN element")
+				}
+			})
+		}
+	}
+}
+
+// RejectNil returns an Option that makes the functions provided
+// by Make panic when passed a nil element, before Compare is
+// called with it. Without it nil elements are passed to Compare
+// like any others, so a Compare that dereferences its arguments
+// panics instead. It has no effect unless the element type is a
+// pointer, interface, map, slice, channel, or function type.
+func RejectNil() Option {
+	return func(t *Tree) {
+		switch t.elemType.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+			t.addGuard(func(v reflect.Value) {
+				if v.IsNil() {
+					panic("avl: nil element")
+				}
+			})
+		}
+	}
+}
+
+func (t *Tree) addGuard(g func(reflect.Value)) {
+	prev := t.guard
+	if prev == nil {
+		t.guard = g
+		return
+	}
+	t.guard = func(v reflect.Value) {
+		prev(v)
+		g(v)
+	}
+}
+
+// Multiset returns an Option that makes the Tree keep every
+// inserted element instead of replacing an element that
+// compares equal to the one being inserted. Equal elements
+// are kept in the order in which they were inserted, so
+// EqualRange and in-order walks yield them first in, first
+// out. This needs no sequence number in each Node: a new
+// element is linked after the elements equal to it, and
+// rotations and deletions preserve the in-order sequence of
+// the rest. Lookup
+// and Delete find or remove an arbitrary one of a group of
+// equal elements; use EqualRange to retrieve all of them.
+func Multiset() Option {
+	return func(t *Tree) {
+		t.multiset = true
+	}
 }
 
 // DummyTree is for documentation purposes only. It is an example
@@ -42,6 +197,8 @@ type DummyTree struct {
 	Insert func(Dummy)
 
 	// Delete deletes a Dummy element from the tree if found.
+	// It may instead be declared as func(Dummy) bool, in which
+	// case it reports whether it deleted an element.
 	Delete func(Dummy)
 
 	// Lookup returns a Dummy element and true if found.
@@ -49,6 +206,344 @@ type DummyTree struct {
 
 	// Value returns the Dummy value from the *avl.Node.
 	Value func(*Node) Dummy
+
+	// LookupRank returns a Dummy element, its 0-based rank in
+	// the tree, and true if found. If it is not found the rank
+	// is -1.
+	LookupRank func(Dummy) (Dummy, int, bool)
+
+	// EqualRange returns all Dummy elements that compare equal
+	// to its argument in the order they were inserted. It is
+	// only available to trees made with the Multiset option.
+	EqualRange func(Dummy) []Dummy
+
+	// Fold calls combine on each Dummy element in ascending
+	// order, passing it the result of the previous call, or
+	// initial for the first call, and returns the final result.
+	// The accumulator is an interface{} so the caller chooses
+	// its dynamic type and asserts it on return.
+	Fold func(initial interface{}, combine func(acc interface{}, v Dummy) interface{}) interface{}
+
+	// RangeFrom calls visit on each Node whose Dummy element
+	// does not compare less than lo, in ascending order, until
+	// visit returns false.
+	RangeFrom func(lo Dummy, visit func(*Node) bool)
+
+	// RangeTo calls visit on each Node whose Dummy element
+	// does not compare greater than hi, in ascending order,
+	// until visit returns false.
+	RangeTo func(hi Dummy, visit func(*Node) bool)
+
+	// Move replaces the Dummy element that compares equal to
+	// old with new. If new still sorts strictly between the
+	// neighbors of old, it is stored in the same Node without
+	// restructuring the tree and Move returns true. Otherwise
+	// old is deleted and new inserted, and Move returns false.
+	// If old is not found, new is simply inserted.
+	Move func(old, new Dummy) bool
+
+	// LookupDepth is like Lookup but examines at most maxDepth
+	// nodes. Its last result is true if it gave up before
+	// finding the Dummy element or establishing its absence.
+	// Since the height of an AVL tree is at most about
+	// 1.44*log2(n), this only bounds the cost of a lookup in
+	// practice if the tree has been corrupted.
+	LookupDepth func(key Dummy, maxDepth int) (Dummy, bool, bool)
+
+	// SelectFromMax returns the (k+1)th largest Dummy element,
+	// the one at 0-based rank Size()-1-k, and true. If k is out
+	// of range it returns the zero value and false.
+	SelectFromMax func(k int) (Dummy, bool)
+
+	// AppendSorted inserts a slice of Dummy elements, each of
+	// which must compare greater than the one before it and
+	// than every element already in the tree. It links them
+	// in as a balanced subtree, which is much faster than
+	// inserting them one by one. If the elements are out of
+	// order it returns an error naming the first offending
+	// element and leaves the tree unchanged.
+	AppendSorted func([]Dummy) error
+
+	// TraceInsert inserts a Dummy element exactly like Insert
+	// and returns a description of each step it took: every
+	// comparison, where the new Node was linked in, and how
+	// the balance factors changed and which rotations were
+	// made on the way back up.
+	TraceInsert func(Dummy) []string
+
+	// SymmetricDiff walks two trees of Dummy elements in step
+	// and returns, each in ascending order, the elements of a
+	// that compare equal to no element of b and those of b
+	// that compare equal to no element of a. Neither tree is
+	// modified. It panics if either tree holds elements of
+	// another type.
+	SymmetricDiff func(a, b *Tree) (onlyA, onlyB []Dummy)
+
+	// ForEachFrom calls visit on each Dummy element that does
+	// not compare less than start, in ascending order, until
+	// visit returns false. Start need not be in the tree; the
+	// first element is found by a single descent from the root.
+	ForEachFrom func(start Dummy, visit func(Dummy) bool)
+
+	// CountWhileOrdered returns the number of Dummy elements for
+	// which pred returns true. Pred must be monotonic in the
+	// order of the tree: true for every element up to some
+	// point and false after it, or the other way around. It
+	// then finds the boundary in a single descent and counts
+	// the elements from the subtree sizes, calling pred
+	// O(log n) times. The result is undefined for predicates
+	// that are not monotonic.
+	CountWhileOrdered func(pred func(Dummy) bool) int
+
+	// LowerBound returns the first Node whose Dummy element
+	// does not compare less than its argument, like C++'s
+	// lower_bound, or nil if there is none. This is the
+	// ceiling of the argument.
+	LowerBound func(Dummy) *Node
+
+	// UpperBound returns the first Node whose Dummy element
+	// compares greater than its argument, like C++'s
+	// upper_bound, or nil if there is none. Its predecessor,
+	// or Max if it is nil, is the floor of the argument. The
+	// elements equal to the argument are those from LowerBound
+	// up to but not including UpperBound.
+	UpperBound func(Dummy) *Node
+
+	// InsertSeq inserts each Dummy element yielded by seq,
+	// which may be an iter.Seq[Dummy]. Elements yielded in
+	// ascending order that compare greater than every element
+	// already in the tree are collected in small batches and
+	// linked in as balanced subtrees, which is much faster than
+	// inserting them one by one. Any other element is inserted
+	// as by Insert, so the result is correct whatever the order
+	// of seq.
+	InsertSeq func(seq func(yield func(Dummy) bool))
+
+	// GetOr returns the Dummy element that compares equal to
+	// key, or def if there is none.
+	GetOr func(key, def Dummy) Dummy
+
+	// ParallelBuild is like AppendSorted but divides the work
+	// of allocating and linking the new nodes among the given
+	// number of goroutines. The order of the elements is still
+	// checked by the calling goroutine, since Compare is not
+	// called concurrently. The new elements form a perfectly
+	// balanced subtree, so building a tree from an empty one
+	// gives the same result as Rebuild. The Copy method of the
+	// tree struct, if it has one, is called concurrently.
+	ParallelBuild func(sorted []Dummy, workers int) error
+
+	// RemoveMin deletes the minimum Dummy element and reports
+	// whether there was one. It is cheaper than looking up the
+	// minimum and deleting it, since it makes no comparisons.
+	RemoveMin func() bool
+
+	// RemoveMax is like RemoveMin but deletes the maximum.
+	RemoveMax func() bool
+
+	// FirstDifference walks two trees of Dummy elements in step
+	// and returns the 0-based index of the first position at
+	// which their elements do not compare equal, the elements
+	// of a and b at that position, and true. If one tree is a
+	// prefix of the other, the index is the size of the shorter
+	// and its element is the zero value. If the trees hold
+	// equal elements it returns -1 and false. It panics if
+	// either tree holds elements of another type.
+	FirstDifference func(a, b *Tree) (index int, va, vb Dummy, ok bool)
+
+	// Clamp returns the stored Dummy element closest to its
+	// argument from below, the greatest element that does not
+	// compare greater than it, and true. If the argument is
+	// less than every element it returns the minimum, so
+	// arguments greater than the maximum give the maximum. It
+	// returns the floor rather than the nearest element since
+	// Compare orders elements but does not measure distances.
+	// It returns false only if the tree is empty.
+	Clamp func(Dummy) (Dummy, bool)
+
+	// HasRange reports whether the tree holds a Dummy element
+	// that compares neither less than lo nor greater than hi.
+	// It finds the first element not less than lo in a single
+	// descent and compares it with hi. It returns false if lo
+	// compares greater than hi.
+	HasRange func(lo, hi Dummy) bool
+
+	// LookupMany looks up each of the Dummy keys and returns
+	// the elements found and whether each was found, in the
+	// order of the keys. For a key that is not found the
+	// element is the zero value. It saves the cost of calling
+	// Lookup through reflection for every key.
+	LookupMany func(keys []Dummy) ([]Dummy, []bool)
+
+	// ReplaceAll replaces the contents of the tree with the
+	// Dummy elements of the slice, which need not be sorted.
+	// It sorts a copy of the slice and links it into a
+	// perfectly balanced tree in O(n log n) time. Of several
+	// elements that compare equal only the last is kept,
+	// as if they were inserted in order, unless the tree is a
+	// multiset. It returns the number of elements dropped that
+	// way, so that unexpected duplicates can be detected. The
+	// old elements are passed to OnEvict. New nodes are
+	// allocated for the new elements, since every Node keeps
+	// its element for as long as it is in the tree.
+	ReplaceAll func([]Dummy) (dups int)
+
+	// Neighbors returns the floor of its argument, the greatest
+	// Dummy element that does not compare greater than it, and
+	// the ceiling, the least element that does not compare
+	// less than it, each with whether it exists. Both are found
+	// in a single descent. If an element compares equal to the
+	// argument it is both the floor and the ceiling.
+	Neighbors func(Dummy) (floor Dummy, floorOk bool, ceil Dummy, ceilOk bool)
+
+	// RangeSeq returns an iterator over the Dummy elements that
+	// compare neither less than lo nor greater than hi, from lo
+	// up to hi if ascending is true and from hi down to lo
+	// otherwise. Its result can be used in a range statement or
+	// converted to an iter.Seq[Dummy]. The first element is found
+	// in a single descent and iteration stops at the other
+	// bound, or as soon as the loop body breaks. The iterator
+	// yields nothing if lo compares greater than hi.
+	RangeSeq func(lo, hi Dummy, ascending bool) func(yield func(Dummy) bool)
+
+	// LookupNode returns the Node holding a Dummy element that
+	// compares equal to its argument, the element, and true. If
+	// there is none it returns nil, the zero value, and false.
+	// The Node can be used to walk on from the element found.
+	LookupNode func(Dummy) (*Node, Dummy, bool)
+
+	// DropMaxN deletes the k maximum Dummy elements, or all of
+	// them if there are fewer, and returns how many it deleted.
+	// It splits them off in one step, as DeleteRankRange does,
+	// rather than deleting them one at a time.
+	DropMaxN func(k int) int
+
+	// Zip walks two trees of Dummy elements in step and calls
+	// visit with each of their elements in ascending order,
+	// as if the trees were merged, until visit returns false.
+	// The second argument of visit reports whether the element
+	// came from a. Of elements that compare equal, those of a
+	// are visited before those of b. Neither tree is copied.
+	// Zip panics if either tree holds elements of another type.
+	Zip func(a, b *Tree, visit func(v Dummy, fromA bool) bool)
+
+	// SampleK returns k Dummy elements chosen uniformly at random
+	// without replacement using r, or every element if there are
+	// fewer than k. It picks k distinct ranks and finds each by
+	// its rank, so it takes O(k log n) time rather than walking
+	// the tree. The order of the sample is unspecified.
+	SampleK func(k int, r *rand.Rand) []Dummy
+
+	// WalkPairs calls visit with each Dummy element in ascending
+	// order, together with the element before it and true, until
+	// visit returns false. For the minimum, which has no element
+	// before it, prev is the zero value and hasPrev is false.
+	WalkPairs func(visit func(prev, cur Dummy, hasPrev bool) bool)
+
+	// Floor returns the greatest Dummy element that does not
+	// compare greater than its argument and true, or the zero
+	// value and false if every element compares greater or the
+	// tree is empty. In a multiset it returns the last of the
+	// elements equal to the argument.
+	Floor func(Dummy) (Dummy, bool)
+
+	// Ceiling returns the least Dummy element that does not
+	// compare less than its argument and true, or the zero
+	// value and false if every element compares less or the
+	// tree is empty. In a multiset it returns the first of the
+	// elements equal to the argument.
+	Ceiling func(Dummy) (Dummy, bool)
+
+	// Higher returns the least Dummy element that compares
+	// greater than its argument and true, or the zero value and
+	// false if there is none. The argument need not be in the
+	// tree.
+	Higher func(Dummy) (Dummy, bool)
+
+	// Lower returns the greatest Dummy element that compares
+	// less than its argument and true, or the zero value and
+	// false if there is none.
+	Lower func(Dummy) (Dummy, bool)
+
+	// Rank returns the number of Dummy elements that compare
+	// less than its argument, which need not be in the tree. It
+	// uses the subtree sizes kept in each Node, so it takes
+	// O(log n) time.
+	Rank func(Dummy) int
+
+	// Select returns the Dummy element of 0-based rank k, the
+	// (k+1)th smallest, and true. If k is out of range it returns
+	// the zero value and false. Like Rank it uses the subtree
+	// sizes, so it takes O(log n) time.
+	Select func(k int) (Dummy, bool)
+
+	// Range calls visit with each Dummy element that does not
+	// compare less than lo but compares less than hi, the
+	// half-open interval [lo, hi), in ascending order until
+	// visit returns false. It finds the first element in a
+	// single descent and walks on from there, so it takes
+	// O(log n + m) time to visit m elements. It visits nothing
+	// if lo does not compare less than hi.
+	Range func(lo, hi Dummy, visit func(Dummy) bool)
+
+	// Count returns the number of Dummy elements that compare
+	// neither less than lo nor greater than hi, or 0 if lo
+	// compares greater than hi. Like Rank it uses the subtree
+	// sizes rather than visiting the elements, so it takes
+	// O(log n) time.
+	Count func(lo, hi Dummy) int
+
+	// DeleteMin deletes the minimum Dummy element and returns it
+	// and true, or the zero value and false if the tree is
+	// empty. Like RemoveMin it finds the element without any
+	// comparisons.
+	DeleteMin func() (Dummy, bool)
+
+	// DeleteMax is like DeleteMin but deletes the maximum.
+	DeleteMax func() (Dummy, bool)
+
+	// InsertIfAbsent inserts a Dummy element if the tree holds
+	// no element that compares equal to it, even in a multiset,
+	// and returns the element stored and true. Otherwise it
+	// leaves the tree unchanged and returns the element found
+	// and false. It descends the tree once.
+	InsertIfAbsent func(Dummy) (Dummy, bool)
+
+	// GetOrInsert returns the Dummy element that compares equal
+	// to its argument and false or, if there is none, inserts
+	// the argument and returns it and true. For a struct element
+	// the argument carries both the key to look up and the
+	// default payload to insert. It is InsertIfAbsent under the
+	// name suited to using the tree as a cache.
+	GetOrInsert func(Dummy) (Dummy, bool)
+
+	// Contains reports whether the tree holds a Dummy element
+	// that compares equal to its argument. It is Lookup without
+	// the element found.
+	Contains func(Dummy) bool
+
+	// ForEach calls visit with each Dummy element in ascending
+	// order until visit returns false.
+	ForEach func(visit func(Dummy) bool)
+
+	// ForEachReverse is like ForEach but visits the Dummy
+	// elements in descending order.
+	ForEachReverse func(visit func(Dummy) bool)
+
+	// Keys returns every Dummy element in ascending order in a
+	// slice of exactly Size elements. It returns an empty,
+	// non-nil slice if the tree is empty.
+	Keys func() []Dummy
+
+	// Build replaces the contents of the tree with a slice of
+	// Dummy elements, each of which must compare greater than
+	// the one before it, or not less in a multiset. It links
+	// them into a perfectly balanced tree in O(n) time, with
+	// no comparisons beyond those checking the order. If the
+	// elements are out of order it returns an error naming the
+	// first offending element and leaves the tree unchanged.
+	// Unlike ReplaceAll it neither copies nor sorts the slice.
+	Build func(sorted []Dummy) error
 }
 
 // Compare is used to determine
@@ -86,11 +581,63 @@ type Dummy interface{}
 // fields for functions of the following types:
 //    Insert func(T)
 //    Delete func(T)
+//    Delete func(T) bool
 //    Lookup func(T) (T, bool)
 //    Value  func(*Node) T
+//    LookupRank func(T) (T, int, bool)
+//    EqualRange func(T) []T
+//    Fold func(interface{}, func(interface{}, T) interface{}) interface{}
+//    RangeFrom func(T, func(*Node) bool)
+//    RangeTo func(T, func(*Node) bool)
+//    Move func(T, T) bool
+//    LookupDepth func(T, int) (T, bool, bool)
+//    SelectFromMax func(int) (T, bool)
+//    AppendSorted func([]T) error
+//    TraceInsert func(T) []string
+//    SymmetricDiff func(*Tree, *Tree) ([]T, []T)
+//    ForEachFrom func(T, func(T) bool)
+//    CountWhileOrdered func(func(T) bool) int
+//    LowerBound func(T) *Node
+//    UpperBound func(T) *Node
+//    InsertSeq func(func(func(T) bool))
+//    GetOr func(T, T) T
+//    ParallelBuild func([]T, int) error
+//    RemoveMin func() bool
+//    RemoveMax func() bool
+//    FirstDifference func(*Tree, *Tree) (int, T, T, bool)
+//    Clamp func(T) (T, bool)
+//    HasRange func(T, T) bool
+//    LookupMany func([]T) ([]T, []bool)
+//    ReplaceAll func([]T) int
+//    Neighbors func(T) (T, bool, T, bool)
+//    RangeSeq func(T, T, bool) func(func(T) bool)
+//    LookupNode func(T) (*Node, T, bool)
+//    DropMaxN func(int) int
+//    Zip func(*Tree, *Tree, func(T, bool) bool)
+//    SampleK func(int, *rand.Rand) []T
+//    WalkPairs func(func(T, T, bool) bool)
+//    Floor func(T) (T, bool)
+//    Ceiling func(T) (T, bool)
+//    Higher func(T) (T, bool)
+//    Lower func(T) (T, bool)
+//    Rank func(T) int
+//    Select func(int) (T, bool)
+//    Range func(T, T, func(T) bool)
+//    Count func(T, T) int
+//    DeleteMin func() (T, bool)
+//    DeleteMax func() (T, bool)
+//    InsertIfAbsent func(T) (T, bool)
+//    GetOrInsert func(T) (T, bool)
+//    Contains func(T) bool
+//    ForEach func(func(T) bool)
+//    ForEachReverse func(func(T) bool)
+//    Keys func() []T
+//    Build func([]T) error
 // Make will provide implementations of these functions that
 // allow type-safe access to values in the tree. There is no
-// error if any of the above functions are missing. See the
+// error if any of the above functions are missing; the Funcs
+// and Provides methods of the Tree report which were provided
+// to code that handles tree structs generically. See the
 // documentation for DummyTree for more information on these
 // functions.
 //
@@ -99,7 +646,65 @@ type Dummy interface{}
 // to provide access to the non type-specific methods defined on the
 // data structure such as, avl.Min, avl.Max, avl.Root, and avl.Size.
 // See the documentation for Node.Next for an example.
-func Make(treeStruct interface{}) error {
+//
+// If treeStruct has a method named OnEvict with the signature
+//     func(T)
+// it is called with each element just before it is removed
+// from the tree. If it has a method named OnReplace with the
+// signature
+//     func(old, new T)
+// it is called when an element old stored in the tree is
+// replaced by new, as when Insert is passed an element that
+// compares equal to old. Each element that leaves the tree is
+// passed to exactly one call of one of these methods, which
+// makes them suitable for returning elements to a pool.
+// These methods must not modify the tree.
+//
+// If treeStruct has a method named OnLookup with the signature
+//     func(key T, found bool)
+// it is called by Lookup, LookupNode, LookupMany, GetOr, and
+// Contains with the key looked up and whether it was found, for example
+// to count hits and misses. It must not modify the tree.
+//
+// Storing an element in the tree copies it like an assignment
+// does: a struct or array is copied, but the memory referred to
+// by pointers, slices, and maps within it is shared with the
+// caller. Changing that memory after insertion changes the
+// stored element as well, and if it changes how the element
+// compares it corrupts the order of the tree. If treeStruct has
+// a method named Copy with the signature
+//     func(T) T
+// every element passed to Insert or any other function that
+// adds elements is replaced by the result of Copy before it is
+// stored, so Copy can make a deep copy that the caller cannot
+// change. Elements passed only to be looked up are not copied.
+//
+// Any Options given are applied to the Tree before the
+// function implementations are provided.
+//
+// Make returns an error if any of the function fields it would
+// provide is already set, as it is if Make has been called on
+// treeStruct before. Making it again would replace its Tree
+// with an empty one and silently lose the elements. To start
+// over with an empty tree, call Make on a new tree struct.
+//
+// Compare must define a total order on the elements. In
+// particular, beware of floating-point NaN values: a NaN is
+// neither less than nor greater than any value, so a Compare
+// written with the < and > operators reports it equal to every
+// element. Inserting a NaN then silently replaces whichever
+// element it is first compared with, and looking up or
+// deleting a NaN finds an arbitrary element. Use the RejectNaN
+// Option to catch such values.
+//
+// If Compare or one of the methods above panics, the panic
+// reaches the caller of the function provided by Make. The
+// functions make their comparisons and call the methods before
+// they change the tree, so the Tree is left valid and, except
+// as noted here, unchanged. Move may have deleted old before a
+// panic while inserting new, and InsertSeq keeps the elements
+// inserted before the panic.
+func Make(treeStruct interface{}, opts ...Option) error {
 	tsVal := reflect.ValueOf(treeStruct)
 
 	cmp := tsVal.MethodByName("Compare")
@@ -109,7 +714,32 @@ func Make(treeStruct interface{}) error {
 	}
 
 	t := &Tree{elemType: cmp.Type().In(0)}
-	t.cmp = makeCmp(cmp)
+	t.cmp = makeCmp(tsVal)
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.checkOrder {
+		err = t.checkNaturalOrder()
+		if err != nil {
+			return err
+		}
+	}
+	if t.memoSize > 0 {
+		err = t.memoize()
+		if err != nil {
+			return err
+		}
+	}
+	if t.cacheSize > 0 {
+		err = t.makeCache()
+		if err != nil {
+			return err
+		}
+	}
+	err = t.makeHooks(tsVal)
+	if err != nil {
+		return err
+	}
 	err = t.makeFnImpls(tsVal)
 	if err != nil {
 		return err
@@ -122,6 +752,83 @@ func Make(treeStruct interface{}) error {
 	return nil
 }
 
+// MustMake is like Make but panics if Make returns an error.
+// Since Make only fails if treeStruct is malformed, which is a
+// programming error, MustMake is the simplest way to make a
+// tree whose struct is known to be correct.
+func MustMake(treeStruct interface{}, opts ...Option) {
+	if err := Make(treeStruct, opts...); err != nil {
+		panic("avl: " + err.Error())
+	}
+}
+
+// MakeChecked is like Make but, if the element type is an
+// integer, floating-point, or string type, it also calls Compare
+// with a sample of pairs of values and returns an error if
+// Compare does not agree with the < operator for any of them.
+// This catches common mistakes in Compare, such as a missing
+// case, when it is meant to order the elements naturally.
+func MakeChecked(treeStruct interface{}, opts ...Option) error {
+	opts = append(opts[:len(opts):len(opts)], func(t *Tree) {
+		t.checkOrder = true
+	})
+	return Make(treeStruct, opts...)
+}
+
+// checkNaturalOrder compares every pair of a few sample values
+// of the element type with t.cmp and with the < operator.
+func (t *Tree) checkNaturalOrder() error {
+	var samples []reflect.Value
+	add := func(set func(reflect.Value)) {
+		v := reflect.New(t.elemType).Elem()
+		set(v)
+		samples = append(samples, v)
+	}
+	var less func(a, b reflect.Value) bool
+	switch t.elemType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		for _, x := range []int64{-100, -2, -1, 0, 1, 2, 3, 100} {
+			add(func(v reflect.Value) { v.SetInt(x) })
+		}
+		less = func(a, b reflect.Value) bool { return a.Int() < b.Int() }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		for _, x := range []uint64{0, 1, 2, 3, 100, 200} {
+			add(func(v reflect.Value) { v.SetUint(x) })
+		}
+		less = func(a, b reflect.Value) bool { return a.Uint() < b.Uint() }
+	case reflect.Float32, reflect.Float64:
+		for _, x := range []float64{-100.5, -1, -0.25, 0, 0.25, 1, 100.5} {
+			add(func(v reflect.Value) { v.SetFloat(x) })
+		}
+		less = func(a, b reflect.Value) bool { return a.Float() < b.Float() }
+	case reflect.String:
+		for _, x := range []string{"", "A", "B", "a", "aa", "ab", "b"} {
+			add(func(v reflect.Value) { v.SetString(x) })
+		}
+		less = func(a, b reflect.Value) bool { return a.String() < b.String() }
+	default:
+		return nil
+	}
+
+	for _, a := range samples {
+		for _, b := range samples {
+			var want int8
+			switch {
+			case less(a, b):
+				want = -1
+			case less(b, a):
+				want = 1
+			}
+			if got := t.cmp(a, b); got != want {
+				return fmt.Errorf("Compare(%v, %v) returned %s, want %s", a, b, cmpNames[got+1], cmpNames[want+1])
+			}
+		}
+	}
+	return nil
+}
+
+var cmpNames = [...]string{"a negative result", "0", "a positive result"}
+
 func checkCompare(cmp reflect.Value) error {
 	if !cmp.IsValid() {
 		return errors.New("Tree interface does not have a Compare method")
@@ -147,12 +854,87 @@ func checkCompare(cmp reflect.Value) error {
 	return nil
 }
 
-func makeCmp(cmp reflect.Value) func(reflect.Value, reflect.Value) int8 {
-	args := make([]reflect.Value, 2)
+// makeHooks finds the optional OnEvict, OnReplace, OnLookup,
+// and Copy methods of the tree struct.
+func (t *Tree) makeHooks(tsVal reflect.Value) error {
+	evict, err := hook(tsVal, "OnEvict", t.elemType)
+	if err != nil {
+		return err
+	}
+	if evict.IsValid() {
+		t.onEvict = func(v reflect.Value) {
+			evict.Call([]reflect.Value{v})
+		}
+	}
+
+	replace, err := hook(tsVal, "OnReplace", t.elemType, t.elemType)
+	if err != nil {
+		return err
+	}
+	if replace.IsValid() {
+		t.onReplace = func(old, new reflect.Value) {
+			replace.Call([]reflect.Value{old, new})
+		}
+	}
+
+	lookup, err := hook(tsVal, "OnLookup", t.elemType, reflect.TypeOf(false))
+	if err != nil {
+		return err
+	}
+	if lookup.IsValid() {
+		t.onLookup = func(key reflect.Value, found bool) {
+			lookup.Call([]reflect.Value{key, reflect.ValueOf(found)})
+		}
+	}
+
+	cp := tsVal.MethodByName("Copy")
+	if cp.IsValid() {
+		typ := reflect.FuncOf([]reflect.Type{t.elemType}, []reflect.Type{t.elemType}, false)
+		if cp.Type() != typ {
+			return fmt.Errorf("Copy method should have signature: %v", typ)
+		}
+		t.copy = func(v reflect.Value) reflect.Value {
+			return cp.Call([]reflect.Value{v})[0]
+		}
+	}
+	return nil
+}
+
+// stored returns the value to be stored for the element v.
+func (t *Tree) stored(v reflect.Value) reflect.Value {
+	if t.copy == nil {
+		return v
+	}
+	return t.copy(v)
+}
+
+// hook returns the method of tsVal with the given name, or the
+// zero Value if there is none. It is an error if the method
+// does not take arguments of the given types and return nothing.
+func hook(tsVal reflect.Value, name string, in ...reflect.Type) (reflect.Value, error) {
+	m := tsVal.MethodByName(name)
+	if !m.IsValid() {
+		return m, nil
+	}
+	typ := reflect.FuncOf(in, nil, false)
+	if m.Type() != typ {
+		return reflect.Value{}, fmt.Errorf("%s method should have signature: %v", name, typ)
+	}
+	return m, nil
+}
+
+// makeCmp calls the Compare method through its method expression
+// with tsVal as the receiver. Calling a method value obtained
+// from MethodByName costs an extra allocation per call and
+// comparisons dominate the cost of every tree operation.
+func makeCmp(tsVal reflect.Value) func(reflect.Value, reflect.Value) int8 {
+	m, _ := tsVal.Type().MethodByName("Compare")
+	args := make([]reflect.Value, 3)
+	args[0] = tsVal
 	return func(a, b reflect.Value) int8 {
-		args[0] = a
-		args[1] = b
-		r := cmp.Call(args)[0].Int()
+		args[1] = a
+		args[2] = b
+		r := m.Func.Call(args)[0].Int()
 		switch {
 		case r < 0:
 			return -1
@@ -164,10 +946,22 @@ func makeCmp(cmp reflect.Value) func(reflect.Value, reflect.Value) int8 {
 	}
 }
 
+var (
+	ifaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+	visitType = reflect.TypeOf((func(*Node) bool)(nil))
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// treeFn describes a function Make provides. The elems are
+// the indices of its element arguments, which are passed to
+// the guard of the Tree. They are listed rather than found by
+// type, since the accumulator of Fold, for one, has the type
+// of the elements in a tree of interface{} elements.
 type treeFn struct {
-	impl func([]reflect.Value) []reflect.Value
-	in   []reflect.Type
-	out  []reflect.Type
+	impl  func([]reflect.Value) []reflect.Value
+	in    []reflect.Type
+	out   []reflect.Type
+	elems []int
 }
 
 func (t *Tree) makeFnImpls(tsVal reflect.Value) error {
@@ -176,88 +970,1187 @@ func (t *Tree) makeFnImpls(tsVal reflect.Value) error {
 			t.insert,
 			[]reflect.Type{t.elemType},
 			[]reflect.Type{},
+			[]int{0},
 		},
 		"Delete": {
 			t.delete,
 			[]reflect.Type{t.elemType},
 			[]reflect.Type{},
+			[]int{0},
 		},
 		"Lookup": {
 			t.lookup,
 			[]reflect.Type{t.elemType},
 			[]reflect.Type{t.elemType, reflect.TypeOf(false)},
+			[]int{0},
 		},
 		"Value": {
 			t.value,
 			[]reflect.Type{reflect.TypeOf(&Node{})},
 			[]reflect.Type{t.elemType},
+			nil,
+		},
+		"LookupRank": {
+			t.lookupRank,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{t.elemType, reflect.TypeOf(0), reflect.TypeOf(false)},
+			[]int{0},
+		},
+		"EqualRange": {
+			t.equalRange,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{reflect.SliceOf(t.elemType)},
+			[]int{0},
+		},
+		"Fold": {
+			t.fold,
+			[]reflect.Type{ifaceType, reflect.FuncOf([]reflect.Type{ifaceType, t.elemType}, []reflect.Type{ifaceType}, false)},
+			[]reflect.Type{ifaceType},
+			nil,
+		},
+		"RangeFrom": {
+			t.rangeFrom,
+			[]reflect.Type{t.elemType, visitType},
+			[]reflect.Type{},
+			[]int{0},
+		},
+		"RangeTo": {
+			t.rangeTo,
+			[]reflect.Type{t.elemType, visitType},
+			[]reflect.Type{},
+			[]int{0},
+		},
+		"Move": {
+			t.move,
+			[]reflect.Type{t.elemType, t.elemType},
+			[]reflect.Type{reflect.TypeOf(false)},
+			[]int{0, 1},
+		},
+		"LookupDepth": {
+			t.lookupDepth,
+			[]reflect.Type{t.elemType, reflect.TypeOf(0)},
+			[]reflect.Type{t.elemType, reflect.TypeOf(false), reflect.TypeOf(false)},
+			[]int{0},
+		},
+		"SelectFromMax": {
+			t.selectFromMax,
+			[]reflect.Type{reflect.TypeOf(0)},
+			[]reflect.Type{t.elemType, reflect.TypeOf(false)},
+			nil,
+		},
+		"AppendSorted": {
+			t.appendSorted,
+			[]reflect.Type{reflect.SliceOf(t.elemType)},
+			[]reflect.Type{errorType},
+			nil,
+		},
+		"TraceInsert": {
+			t.traceInsert,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{reflect.TypeOf([]string(nil))},
+			[]int{0},
+		},
+		"SymmetricDiff": {
+			t.symmetricDiff,
+			[]reflect.Type{reflect.TypeOf(&Tree{}), reflect.TypeOf(&Tree{})},
+			[]reflect.Type{reflect.SliceOf(t.elemType), reflect.SliceOf(t.elemType)},
+			nil,
+		},
+		"ForEachFrom": {
+			t.forEachFrom,
+			[]reflect.Type{t.elemType, reflect.FuncOf([]reflect.Type{t.elemType}, []reflect.Type{reflect.TypeOf(false)}, false)},
+			[]reflect.Type{},
+			[]int{0},
+		},
+		"CountWhileOrdered": {
+			t.countWhileOrdered,
+			[]reflect.Type{reflect.FuncOf([]reflect.Type{t.elemType}, []reflect.Type{reflect.TypeOf(false)}, false)},
+			[]reflect.Type{reflect.TypeOf(0)},
+			nil,
+		},
+		"LowerBound": {
+			t.lowerBoundFn,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{reflect.TypeOf(&Node{})},
+			[]int{0},
+		},
+		"UpperBound": {
+			t.upperBoundFn,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{reflect.TypeOf(&Node{})},
+			[]int{0},
+		},
+		"InsertSeq": {
+			t.insertSeq,
+			[]reflect.Type{reflect.FuncOf([]reflect.Type{reflect.FuncOf([]reflect.Type{t.elemType}, []reflect.Type{reflect.TypeOf(false)}, false)}, nil, false)},
+			[]reflect.Type{},
+			nil,
+		},
+		"GetOr": {
+			t.getOr,
+			[]reflect.Type{t.elemType, t.elemType},
+			[]reflect.Type{t.elemType},
+			[]int{0, 1},
+		},
+		"ParallelBuild": {
+			t.parallelBuild,
+			[]reflect.Type{reflect.SliceOf(t.elemType), reflect.TypeOf(0)},
+			[]reflect.Type{errorType},
+			nil,
+		},
+		"RemoveMin": {
+			t.removeMin,
+			[]reflect.Type{},
+			[]reflect.Type{reflect.TypeOf(false)},
+			nil,
+		},
+		"RemoveMax": {
+			t.removeMax,
+			[]reflect.Type{},
+			[]reflect.Type{reflect.TypeOf(false)},
+			nil,
+		},
+		"FirstDifference": {
+			t.firstDifference,
+			[]reflect.Type{reflect.TypeOf(&Tree{}), reflect.TypeOf(&Tree{})},
+			[]reflect.Type{reflect.TypeOf(0), t.elemType, t.elemType, reflect.TypeOf(false)},
+			nil,
+		},
+		"Clamp": {
+			t.clamp,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{t.elemType, reflect.TypeOf(false)},
+			[]int{0},
+		},
+		"HasRange": {
+			t.hasRange,
+			[]reflect.Type{t.elemType, t.elemType},
+			[]reflect.Type{reflect.TypeOf(false)},
+			[]int{0, 1},
+		},
+		"LookupMany": {
+			t.lookupMany,
+			[]reflect.Type{reflect.SliceOf(t.elemType)},
+			[]reflect.Type{reflect.SliceOf(t.elemType), reflect.TypeOf([]bool(nil))},
+			nil,
+		},
+		"ReplaceAll": {
+			t.replaceAll,
+			[]reflect.Type{reflect.SliceOf(t.elemType)},
+			[]reflect.Type{reflect.TypeOf(0)},
+			nil,
+		},
+		"Neighbors": {
+			t.neighbors,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{t.elemType, reflect.TypeOf(false), t.elemType, reflect.TypeOf(false)},
+			[]int{0},
+		},
+		"RangeSeq": {
+			t.rangeSeq,
+			[]reflect.Type{t.elemType, t.elemType, reflect.TypeOf(false)},
+			[]reflect.Type{reflect.FuncOf([]reflect.Type{reflect.FuncOf([]reflect.Type{t.elemType}, []reflect.Type{reflect.TypeOf(false)}, false)}, nil, false)},
+			[]int{0, 1},
+		},
+		"LookupNode": {
+			t.lookupNode,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{reflect.TypeOf(&Node{}), t.elemType, reflect.TypeOf(false)},
+			[]int{0},
+		},
+		"DropMaxN": {
+			t.dropMaxN,
+			[]reflect.Type{reflect.TypeOf(0)},
+			[]reflect.Type{reflect.TypeOf(0)},
+			nil,
+		},
+		"Zip": {
+			t.zip,
+			[]reflect.Type{reflect.TypeOf(&Tree{}), reflect.TypeOf(&Tree{}), reflect.FuncOf([]reflect.Type{t.elemType, reflect.TypeOf(false)}, []reflect.Type{reflect.TypeOf(false)}, false)},
+			[]reflect.Type{},
+			nil,
+		},
+		"SampleK": {
+			t.sampleK,
+			[]reflect.Type{reflect.TypeOf(0), reflect.TypeOf(&rand.Rand{})},
+			[]reflect.Type{reflect.SliceOf(t.elemType)},
+			nil,
+		},
+		"WalkPairs": {
+			t.walkPairs,
+			[]reflect.Type{reflect.FuncOf([]reflect.Type{t.elemType, t.elemType, reflect.TypeOf(false)}, []reflect.Type{reflect.TypeOf(false)}, false)},
+			[]reflect.Type{},
+			nil,
+		},
+		"Floor": {
+			t.floor,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{t.elemType, reflect.TypeOf(false)},
+			[]int{0},
+		},
+		"Ceiling": {
+			t.ceiling,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{t.elemType, reflect.TypeOf(false)},
+			[]int{0},
+		},
+		"Higher": {
+			t.higher,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{t.elemType, reflect.TypeOf(false)},
+			[]int{0},
+		},
+		"Lower": {
+			t.lower,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{t.elemType, reflect.TypeOf(false)},
+			[]int{0},
+		},
+		"Rank": {
+			t.rank,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{reflect.TypeOf(0)},
+			[]int{0},
+		},
+		"Select": {
+			t.selectFn,
+			[]reflect.Type{reflect.TypeOf(0)},
+			[]reflect.Type{t.elemType, reflect.TypeOf(false)},
+			nil,
+		},
+		"Range": {
+			t.rangeFn,
+			[]reflect.Type{t.elemType, t.elemType, reflect.FuncOf([]reflect.Type{t.elemType}, []reflect.Type{reflect.TypeOf(false)}, false)},
+			[]reflect.Type{},
+			[]int{0, 1},
+		},
+		"Count": {
+			t.count,
+			[]reflect.Type{t.elemType, t.elemType},
+			[]reflect.Type{reflect.TypeOf(0)},
+			[]int{0, 1},
+		},
+		"DeleteMin": {
+			t.deleteMinFn,
+			[]reflect.Type{},
+			[]reflect.Type{t.elemType, reflect.TypeOf(false)},
+			nil,
+		},
+		"DeleteMax": {
+			t.deleteMaxFn,
+			[]reflect.Type{},
+			[]reflect.Type{t.elemType, reflect.TypeOf(false)},
+			nil,
+		},
+		"InsertIfAbsent": {
+			t.insertIfAbsent,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{t.elemType, reflect.TypeOf(false)},
+			[]int{0},
+		},
+		"GetOrInsert": {
+			t.insertIfAbsent,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{t.elemType, reflect.TypeOf(false)},
+			[]int{0},
+		},
+		"Contains": {
+			t.contains,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{reflect.TypeOf(false)},
+			[]int{0},
 		},
+		"ForEach": {
+			t.forEach,
+			[]reflect.Type{reflect.FuncOf([]reflect.Type{t.elemType}, []reflect.Type{reflect.TypeOf(false)}, false)},
+			[]reflect.Type{},
+			nil,
+		},
+		"ForEachReverse": {
+			t.forEachReverse,
+			[]reflect.Type{reflect.FuncOf([]reflect.Type{t.elemType}, []reflect.Type{reflect.TypeOf(false)}, false)},
+			[]reflect.Type{},
+			nil,
+		},
+		"Keys": {
+			t.keys,
+			[]reflect.Type{},
+			[]reflect.Type{reflect.SliceOf(t.elemType)},
+			nil,
+		},
+		"Build": {
+			t.buildFn,
+			[]reflect.Type{reflect.SliceOf(t.elemType)},
+			[]reflect.Type{errorType},
+			nil,
+		},
+	}
+
+	// Delete may be declared to report whether it deleted
+	// anything.
+	if fnVal := tsVal.Elem().FieldByName("Delete"); fnVal.IsValid() && fnVal.Kind() == reflect.Func && fnVal.Type().NumOut() == 1 {
+		fns["Delete"] = treeFn{
+			t.deleteReporting,
+			[]reflect.Type{t.elemType},
+			[]reflect.Type{reflect.TypeOf(false)},
+			[]int{0},
+		}
 	}
 
+	// Check every field before setting any, so that the tree
+	// struct is left unchanged if there is an error.
 	for name, tf := range fns {
 		fnVal := tsVal.Elem().FieldByName(name)
 		if !fnVal.IsValid() {
+			delete(fns, name)
 			continue
 		}
 		typ := reflect.FuncOf(tf.in, tf.out, false)
 		if fnVal.Type() != typ {
 			return fmt.Errorf("%s function should have signature: %v", name, typ)
 		}
-		fnVal.Set(reflect.MakeFunc(typ, tf.impl))
+		if name == "EqualRange" && !t.multiset {
+			return errors.New("EqualRange function requires the Multiset option")
+		}
+		if !fnVal.IsNil() {
+			return fmt.Errorf("%s function is already set; Make may have been called twice", name)
+		}
 	}
+	for name, tf := range fns {
+		fnVal := tsVal.Elem().FieldByName(name)
+		typ := reflect.FuncOf(tf.in, tf.out, false)
+		impl := tf.impl
+		if t.guard != nil {
+			impl = t.guarded(impl, tf.elems)
+		}
+		fnVal.Set(reflect.MakeFunc(typ, impl))
+		t.funcs = append(t.funcs, name)
+	}
+	sort.Strings(t.funcs)
+
+	return nil
+}
+
+// Funcs returns the names of the function fields of the tree
+// struct that Make provided, in sorted order.
+func (t *Tree) Funcs() []string {
+	return append([]string(nil), t.funcs...)
+}
+
+// Provides reports whether Make provided the function field
+// of the tree struct with the given name, so that it is safe
+// to call.
+func (t *Tree) Provides(name string) bool {
+	i := sort.SearchStrings(t.funcs, name)
+	return i < len(t.funcs) && t.funcs[i] == name
+}
+
+// guarded wraps impl so that the arguments with the given
+// indices are passed to t.guard before impl is called.
+func (t *Tree) guarded(impl func([]reflect.Value) []reflect.Value, elems []int) func([]reflect.Value) []reflect.Value {
+	if len(elems) == 0 {
+		return impl
+	}
+	return func(in []reflect.Value) []reflect.Value {
+		for _, i := range elems {
+			t.guard(in[i])
+		}
+		return impl(in)
+	}
+}
 
-	return nil
-}
-
 func (t *Tree) lookup(in []reflect.Value) []reflect.Value {
 	val := in[0]
 	if val.Type() != t.elemType {
 		panic("lookup of wrong type")
 	}
+	if n := t.findObserved(val); n != nil {
+		return []reflect.Value{n.val, reflect.ValueOf(true)}
+	}
+	return []reflect.Value{reflect.Zero(t.elemType), reflect.ValueOf(false)}
+}
+
+func (t *Tree) contains(in []reflect.Value) []reflect.Value {
+	return []reflect.Value{reflect.ValueOf(t.findObserved(in[0]) != nil)}
+}
+
+func (t *Tree) lookupMany(in []reflect.Value) []reflect.Value {
+	keys := in[0]
+	nkeys := keys.Len()
+	vals := reflect.MakeSlice(reflect.SliceOf(t.elemType), nkeys, nkeys)
+	found := make([]bool, nkeys)
+	for i := range found {
+		key := keys.Index(i)
+		if t.guard != nil {
+			t.guard(key)
+		}
+		if n := t.findObserved(key); n != nil {
+			vals.Index(i).Set(n.val)
+			found[i] = true
+		}
+	}
+	return []reflect.Value{vals, reflect.ValueOf(found)}
+}
+
+func (t *Tree) lookupNode(in []reflect.Value) []reflect.Value {
+	if n := t.findObserved(in[0]); n != nil {
+		return []reflect.Value{reflect.ValueOf(n), n.val, reflect.ValueOf(true)}
+	}
+	return []reflect.Value{reflect.ValueOf((*Node)(nil)), reflect.Zero(t.elemType), reflect.ValueOf(false)}
+}
+
+func (t *Tree) getOr(in []reflect.Value) []reflect.Value {
+	if n := t.findObserved(in[0]); n != nil {
+		return []reflect.Value{n.val}
+	}
+	return []reflect.Value{in[1]}
+}
+
+// findObserved is like find but uses the lookup cache, if
+// any, and reports the result to the OnLookup method of the
+// tree struct.
+func (t *Tree) findObserved(val reflect.Value) *Node {
+	var n *Node
+	if t.cache != nil {
+		n = t.cache.find(t, val)
+	} else {
+		n = t.find(val)
+	}
+	if t.onLookup != nil {
+		t.onLookup(val, n != nil)
+	}
+	return n
+}
+
+// find returns the node holding an element that compares
+// equal to val or nil if there is none.
+func (t *Tree) find(val reflect.Value) *Node {
 	n := t.root
 	for n != nil {
 		switch t.cmp(val, n.val) {
 		case -1:
 			n = n.c[0]
 		case 0:
-			return []reflect.Value{n.val, reflect.ValueOf(true)}
+			return n
 		case 1:
 			n = n.c[1]
 		}
 	}
+	return nil
+}
+
+func (t *Tree) lookupRank(in []reflect.Value) []reflect.Value {
+	val := in[0]
+	if val.Type() != t.elemType {
+		panic("lookup of wrong type")
+	}
+	rank := 0
+	n := t.root
+	for n != nil {
+		switch t.cmp(val, n.val) {
+		case -1:
+			n = n.c[0]
+		case 0:
+			rank += sizeOf(n.c[0])
+			return []reflect.Value{n.val, reflect.ValueOf(rank), reflect.ValueOf(true)}
+		case 1:
+			rank += sizeOf(n.c[0]) + 1
+			n = n.c[1]
+		}
+	}
+	return []reflect.Value{reflect.Zero(t.elemType), reflect.ValueOf(-1), reflect.ValueOf(false)}
+}
+
+func (t *Tree) rank(in []reflect.Value) []reflect.Value {
+	return []reflect.Value{reflect.ValueOf(t.countBelow(in[0], false))}
+}
+
+func (t *Tree) count(in []reflect.Value) []reflect.Value {
+	lo, hi := in[0], in[1]
+	n := 0
+	if t.cmp(lo, hi) <= 0 {
+		n = t.countBelow(hi, true) - t.countBelow(lo, false)
+	}
+	return []reflect.Value{reflect.ValueOf(n)}
+}
+
+// countBelow returns the number of elements that compare
+// less than val or, if inclusive is true, not greater than it.
+func (t *Tree) countBelow(val reflect.Value, inclusive bool) int {
+	limit := int8(1)
+	if inclusive {
+		limit = 0
+	}
+	rank := 0
+	for n := t.root; n != nil; {
+		if t.cmp(val, n.val) < limit {
+			n = n.c[0]
+		} else {
+			rank += sizeOf(n.c[0]) + 1
+			n = n.c[1]
+		}
+	}
+	return rank
+}
+
+func (t *Tree) equalRange(in []reflect.Value) []reflect.Value {
+	val := in[0]
+	if val.Type() != t.elemType {
+		panic("lookup of wrong type")
+	}
+	vals := reflect.MakeSlice(reflect.SliceOf(t.elemType), 0, 0)
+	for n := t.lowerBound(val); n != nil && t.cmp(val, n.val) == 0; n = n.Next() {
+		vals = reflect.Append(vals, n.val)
+	}
+	return []reflect.Value{vals}
+}
+
+// lowerBound returns the first node whose value does not
+// compare less than val or nil if there is none.
+func (t *Tree) lowerBound(val reflect.Value) *Node {
+	var lb *Node
+	n := t.root
+	for n != nil {
+		if t.cmp(val, n.val) <= 0 {
+			lb = n
+			n = n.c[0]
+		} else {
+			n = n.c[1]
+		}
+	}
+	return lb
+}
+
+func (t *Tree) lowerBoundFn(in []reflect.Value) []reflect.Value {
+	return []reflect.Value{reflect.ValueOf(t.lowerBound(in[0]))}
+}
+
+func (t *Tree) upperBoundFn(in []reflect.Value) []reflect.Value {
+	return []reflect.Value{reflect.ValueOf(t.upperBound(in[0]))}
+}
+
+// upperBound returns the first node whose value compares
+// greater than val or nil if there is none.
+func (t *Tree) upperBound(val reflect.Value) *Node {
+	var ub *Node
+	n := t.root
+	for n != nil {
+		if t.cmp(val, n.val) < 0 {
+			ub = n
+			n = n.c[0]
+		} else {
+			n = n.c[1]
+		}
+	}
+	return ub
+}
+
+// floorNode returns the last node whose value does not
+// compare greater than val or nil if there is none.
+func (t *Tree) floorNode(val reflect.Value) *Node {
+	var fl *Node
+	n := t.root
+	for n != nil {
+		if t.cmp(n.val, val) <= 0 {
+			fl = n
+			n = n.c[1]
+		} else {
+			n = n.c[0]
+		}
+	}
+	return fl
+}
+
+func (t *Tree) floor(in []reflect.Value) []reflect.Value {
+	return t.found(t.floorNode(in[0]))
+}
+
+func (t *Tree) ceiling(in []reflect.Value) []reflect.Value {
+	return t.found(t.lowerBound(in[0]))
+}
+
+func (t *Tree) higher(in []reflect.Value) []reflect.Value {
+	return t.found(t.upperBound(in[0]))
+}
+
+func (t *Tree) lower(in []reflect.Value) []reflect.Value {
+	var lo *Node
+	n := t.root
+	for n != nil {
+		if t.cmp(n.val, in[0]) < 0 {
+			lo = n
+			n = n.c[1]
+		} else {
+			n = n.c[0]
+		}
+	}
+	return t.found(lo)
+}
+
+// found returns the results of a function that returns
+// the element of n and true, or the zero value and false
+// if n is nil.
+func (t *Tree) found(n *Node) []reflect.Value {
+	if n != nil {
+		return []reflect.Value{n.val, reflect.ValueOf(true)}
+	}
 	return []reflect.Value{reflect.Zero(t.elemType), reflect.ValueOf(false)}
 }
 
+func (t *Tree) clamp(in []reflect.Value) []reflect.Value {
+	if t.root == nil {
+		return []reflect.Value{reflect.Zero(t.elemType), reflect.ValueOf(false)}
+	}
+	var n *Node
+	if ub := t.upperBound(in[0]); ub != nil {
+		n = ub.Prev()
+	} else {
+		n = t.Max()
+	}
+	if n == nil {
+		n = t.Min()
+	}
+	return []reflect.Value{n.val, reflect.ValueOf(true)}
+}
+
+func (t *Tree) hasRange(in []reflect.Value) []reflect.Value {
+	n := t.lowerBound(in[0])
+	return []reflect.Value{reflect.ValueOf(n != nil && t.cmp(n.val, in[1]) <= 0)}
+}
+
+func (t *Tree) replaceAll(in []reflect.Value) []reflect.Value {
+	vals := reflect.MakeSlice(in[0].Type(), in[0].Len(), in[0].Len())
+	reflect.Copy(vals, in[0])
+	if t.guard != nil {
+		for i := 0; i < vals.Len(); i++ {
+			t.guard(vals.Index(i))
+		}
+	}
+	sort.SliceStable(vals.Interface(), func(i, j int) bool {
+		return t.cmp(vals.Index(i), vals.Index(j)) < 0
+	})
+
+	nodes := make([]*Node, 0, vals.Len())
+	for i := 0; i < vals.Len(); i++ {
+		v := vals.Index(i)
+		if !t.multiset && i+1 < vals.Len() && t.cmp(v, vals.Index(i+1)) == 0 {
+			continue
+		}
+		nodes = append(nodes, &Node{val: t.stored(v)})
+	}
+
+	old := t.root
+	t.root, _ = build(nodes, nil)
+	t.size = len(nodes)
+	t.deleted = 0
+	t.resetExtremes()
+	t.discard(old)
+	return []reflect.Value{reflect.ValueOf(vals.Len() - len(nodes))}
+}
+
+func (t *Tree) buildFn(in []reflect.Value) []reflect.Value {
+	vals := in[0]
+	if err := t.checkSorted("Build", vals, reflect.Value{}); err != nil {
+		return []reflect.Value{reflect.ValueOf(&err).Elem()}
+	}
+	nodes := make([]*Node, vals.Len())
+	for i := range nodes {
+		nodes[i] = &Node{val: t.stored(vals.Index(i))}
+	}
+
+	old := t.root
+	t.root, _ = build(nodes, nil)
+	t.size = len(nodes)
+	t.deleted = 0
+	t.resetExtremes()
+	t.discard(old)
+	return []reflect.Value{reflect.Zero(errorType)}
+}
+
+func (t *Tree) neighbors(in []reflect.Value) []reflect.Value {
+	val := in[0]
+	var lo, hi *Node
+	for n := t.root; n != nil; {
+		c := t.cmp(val, n.val)
+		if c == 0 {
+			lo, hi = n, n
+			break
+		}
+		if c < 0 {
+			hi = n
+			n = n.c[0]
+		} else {
+			lo = n
+			n = n.c[1]
+		}
+	}
+	out := make([]reflect.Value, 0, 4)
+	for _, n := range [...]*Node{lo, hi} {
+		if n == nil {
+			out = append(out, reflect.Zero(t.elemType), reflect.ValueOf(false))
+		} else {
+			out = append(out, n.val, reflect.ValueOf(true))
+		}
+	}
+	return out
+}
+
+func (t *Tree) rangeFn(in []reflect.Value) []reflect.Value {
+	lo, hi, visit := in[0], in[1], in[2]
+	if t.cmp(lo, hi) >= 0 {
+		return nil
+	}
+	args := make([]reflect.Value, 1)
+	end := t.lowerBound(hi)
+	for n := t.lowerBound(lo); n != nil && n != end; n = n.Next() {
+		args[0] = n.val
+		if !visit.Call(args)[0].Bool() {
+			break
+		}
+	}
+	return nil
+}
+
+func (t *Tree) rangeSeq(in []reflect.Value) []reflect.Value {
+	lo, hi, ascending := in[0], in[1], in[2].Bool()
+	yieldType := reflect.FuncOf([]reflect.Type{t.elemType}, []reflect.Type{reflect.TypeOf(false)}, false)
+	seqType := reflect.FuncOf([]reflect.Type{yieldType}, nil, false)
+	seq := reflect.MakeFunc(seqType, func(in []reflect.Value) []reflect.Value {
+		if t.cmp(lo, hi) > 0 {
+			return nil
+		}
+		// Walk from n in direction d until end,
+		// the first element beyond the other bound.
+		yield := in[0]
+		args := make([]reflect.Value, 1)
+		var n, end *Node
+		d := 1
+		if ascending {
+			n, end = t.lowerBound(lo), t.upperBound(hi)
+		} else {
+			d = 0
+			if n = t.upperBound(hi); n != nil {
+				n = n.Prev()
+			} else {
+				n = t.Max()
+			}
+			if end = t.lowerBound(lo); end != nil {
+				end = end.Prev()
+			} else {
+				end = t.Max()
+			}
+		}
+		for ; n != nil && n != end; n = n.walk1(d) {
+			args[0] = n.val
+			if !yield.Call(args)[0].Bool() {
+				break
+			}
+		}
+		return nil
+	})
+	return []reflect.Value{seq}
+}
+
+func (t *Tree) fold(in []reflect.Value) []reflect.Value {
+	acc, combine := in[0], in[1]
+	args := make([]reflect.Value, 2)
+	for n := t.Min(); n != nil; n = n.Next() {
+		args[0] = acc
+		args[1] = n.val
+		acc = combine.Call(args)[0]
+	}
+	return []reflect.Value{acc}
+}
+
+func (t *Tree) rangeFrom(in []reflect.Value) []reflect.Value {
+	lo, visit := in[0], in[1].Interface().(func(*Node) bool)
+	for n := t.lowerBound(lo); n != nil; n = n.Next() {
+		if !visit(n) {
+			break
+		}
+	}
+	return nil
+}
+
+func (t *Tree) forEach(in []reflect.Value) []reflect.Value {
+	visitFrom(t.Min(), 1, in[0])
+	return nil
+}
+
+func (t *Tree) forEachReverse(in []reflect.Value) []reflect.Value {
+	visitFrom(t.Max(), 0, in[0])
+	return nil
+}
+
+// visitFrom calls visit with the element of n and those after
+// it in direction d of an in-order walk until visit returns
+// false.
+func visitFrom(n *Node, d int, visit reflect.Value) {
+	args := make([]reflect.Value, 1)
+	for ; n != nil; n = n.walk1(d) {
+		args[0] = n.val
+		if !visit.Call(args)[0].Bool() {
+			break
+		}
+	}
+}
+
+func (t *Tree) keys(in []reflect.Value) []reflect.Value {
+	vals := reflect.MakeSlice(reflect.SliceOf(t.elemType), t.Size(), t.Size())
+	i := 0
+	for n := t.Min(); n != nil; n = n.Next() {
+		vals.Index(i).Set(n.val)
+		i++
+	}
+	return []reflect.Value{vals}
+}
+
+func (t *Tree) forEachFrom(in []reflect.Value) []reflect.Value {
+	visitFrom(t.lowerBound(in[0]), 1, in[1])
+	return nil
+}
+
+func (t *Tree) walkPairs(in []reflect.Value) []reflect.Value {
+	visit := in[0]
+	args := []reflect.Value{reflect.Zero(t.elemType), {}, reflect.ValueOf(false)}
+	for n := t.Min(); n != nil; n = n.Next() {
+		args[1] = n.val
+		if !visit.Call(args)[0].Bool() {
+			break
+		}
+		args[0], args[2] = n.val, reflect.ValueOf(true)
+	}
+	return nil
+}
+
+func (t *Tree) countWhileOrdered(in []reflect.Value) []reflect.Value {
+	pred := in[0]
+	min := t.Min()
+	if min == nil {
+		return []reflect.Value{reflect.ValueOf(0)}
+	}
+	args := make([]reflect.Value, 1)
+	args[0] = min.val
+	first := pred.Call(args)[0].Bool()
+
+	// Find the rank of the first element for which
+	// pred differs from its value at the minimum.
+	rank := 0
+	for n := t.root; n != nil; {
+		args[0] = n.val
+		if pred.Call(args)[0].Bool() == first {
+			rank += sizeOf(n.c[0]) + 1
+			n = n.c[1]
+		} else {
+			n = n.c[0]
+		}
+	}
+	if !first {
+		rank = t.size - rank
+	}
+	return []reflect.Value{reflect.ValueOf(rank)}
+}
+
+func (t *Tree) rangeTo(in []reflect.Value) []reflect.Value {
+	hi, visit := in[0], in[1].Interface().(func(*Node) bool)
+	for n := t.Min(); n != nil && t.cmp(n.val, hi) <= 0; n = n.Next() {
+		if !visit(n) {
+			break
+		}
+	}
+	return nil
+}
+
+func (t *Tree) move(in []reflect.Value) []reflect.Value {
+	old, val := in[0], in[1]
+	if n := t.find(old); n != nil {
+		prev, next := n.Prev(), n.Next()
+		if (prev == nil || t.cmp(prev.val, val) < 0) && (next == nil || t.cmp(val, next.val) < 0) {
+			val = t.stored(val)
+			if t.onReplace != nil {
+				t.onReplace(n.val, val)
+			}
+			n.val = val
+			return []reflect.Value{reflect.ValueOf(true)}
+		}
+		t.delete(in[:1])
+	}
+	t.insert(in[1:])
+	return []reflect.Value{reflect.ValueOf(false)}
+}
+
+func (t *Tree) lookupDepth(in []reflect.Value) []reflect.Value {
+	val, maxDepth := in[0], int(in[1].Int())
+	n := t.root
+	for depth := 0; n != nil; depth++ {
+		if depth == maxDepth {
+			return []reflect.Value{reflect.Zero(t.elemType), reflect.ValueOf(false), reflect.ValueOf(true)}
+		}
+		switch t.cmp(val, n.val) {
+		case -1:
+			n = n.c[0]
+		case 0:
+			return []reflect.Value{n.val, reflect.ValueOf(true), reflect.ValueOf(false)}
+		case 1:
+			n = n.c[1]
+		}
+	}
+	return []reflect.Value{reflect.Zero(t.elemType), reflect.ValueOf(false), reflect.ValueOf(false)}
+}
+
+func (t *Tree) selectFn(in []reflect.Value) []reflect.Value {
+	return t.found(t.selectNode(int(in[0].Int())))
+}
+
+func (t *Tree) selectFromMax(in []reflect.Value) []reflect.Value {
+	k := int(in[0].Int())
+	if n := t.selectNode(t.size - 1 - k); n != nil {
+		return []reflect.Value{n.val, reflect.ValueOf(true)}
+	}
+	return []reflect.Value{reflect.Zero(t.elemType), reflect.ValueOf(false)}
+}
+
+func (t *Tree) sampleK(in []reflect.Value) []reflect.Value {
+	k := int(in[0].Int())
+	r := in[1].Interface().(*rand.Rand)
+	if k > t.size {
+		k = t.size
+	}
+	if k < 0 {
+		k = 0
+	}
+	sample := reflect.MakeSlice(reflect.SliceOf(t.elemType), 0, k)
+	// Floyd's algorithm chooses k distinct ranks
+	// with exactly k calls to r.
+	chosen := make(map[int]bool, k)
+	for j := t.size - k; j < t.size; j++ {
+		rank := r.Intn(j + 1)
+		if chosen[rank] {
+			rank = j
+		}
+		chosen[rank] = true
+		sample = reflect.Append(sample, t.selectNode(rank).val)
+	}
+	return []reflect.Value{sample}
+}
+
+// selectNode returns the node of 0-based rank k or nil if
+// k is out of range.
+func (t *Tree) selectNode(k int) *Node {
+	if k < 0 || k >= t.size {
+		return nil
+	}
+	n := t.root
+	for {
+		l := sizeOf(n.c[0])
+		switch {
+		case k < l:
+			n = n.c[0]
+		case k == l:
+			return n
+		default:
+			k -= l + 1
+			n = n.c[1]
+		}
+	}
+}
+
+func (t *Tree) traceInsert(in []reflect.Value) []reflect.Value {
+	var steps []string
+	t.tracef = func(format string, args ...interface{}) {
+		steps = append(steps, fmt.Sprintf(format, args...))
+	}
+	defer func() {
+		t.tracef = nil
+	}()
+	t.insert(in)
+	return []reflect.Value{reflect.ValueOf(steps)}
+}
+
+func (t *Tree) firstDifference(in []reflect.Value) []reflect.Value {
+	a := in[0].Interface().(*Tree)
+	b := in[1].Interface().(*Tree)
+	if a.elemType != t.elemType || b.elemType != t.elemType {
+		panic("FirstDifference of trees of different types")
+	}
+	zero := reflect.Zero(t.elemType)
+	x, y := a.Min(), b.Min()
+	for i := 0; x != nil || y != nil; i++ {
+		switch {
+		case y == nil:
+			return []reflect.Value{reflect.ValueOf(i), x.val, zero, reflect.ValueOf(true)}
+		case x == nil:
+			return []reflect.Value{reflect.ValueOf(i), zero, y.val, reflect.ValueOf(true)}
+		case t.cmp(x.val, y.val) != 0:
+			return []reflect.Value{reflect.ValueOf(i), x.val, y.val, reflect.ValueOf(true)}
+		}
+		x, y = x.Next(), y.Next()
+	}
+	return []reflect.Value{reflect.ValueOf(-1), zero, zero, reflect.ValueOf(false)}
+}
+
+func (t *Tree) zip(in []reflect.Value) []reflect.Value {
+	a := in[0].Interface().(*Tree)
+	b := in[1].Interface().(*Tree)
+	visit := in[2]
+	if a.elemType != t.elemType || b.elemType != t.elemType {
+		panic("Zip of trees of different types")
+	}
+	args := make([]reflect.Value, 2)
+	x, y := a.Min(), b.Min()
+	for x != nil || y != nil {
+		if y == nil || x != nil && t.cmp(x.val, y.val) <= 0 {
+			args[0], args[1] = x.val, reflect.ValueOf(true)
+			x = x.Next()
+		} else {
+			args[0], args[1] = y.val, reflect.ValueOf(false)
+			y = y.Next()
+		}
+		if !visit.Call(args)[0].Bool() {
+			break
+		}
+	}
+	return nil
+}
+
+func (t *Tree) symmetricDiff(in []reflect.Value) []reflect.Value {
+	a := in[0].Interface().(*Tree)
+	b := in[1].Interface().(*Tree)
+	if a.elemType != t.elemType || b.elemType != t.elemType {
+		panic("SymmetricDiff of trees of different types")
+	}
+	onlyA := reflect.MakeSlice(reflect.SliceOf(t.elemType), 0, 0)
+	onlyB := reflect.MakeSlice(reflect.SliceOf(t.elemType), 0, 0)
+	x, y := a.Min(), b.Min()
+	for x != nil && y != nil {
+		switch t.cmp(x.val, y.val) {
+		case -1:
+			onlyA = reflect.Append(onlyA, x.val)
+			x = x.Next()
+		case 0:
+			x, y = x.Next(), y.Next()
+		case 1:
+			onlyB = reflect.Append(onlyB, y.val)
+			y = y.Next()
+		}
+	}
+	for ; x != nil; x = x.Next() {
+		onlyA = reflect.Append(onlyA, x.val)
+	}
+	for ; y != nil; y = y.Next() {
+		onlyB = reflect.Append(onlyB, y.val)
+	}
+	return []reflect.Value{onlyA, onlyB}
+}
+
 func (t *Tree) insert(in []reflect.Value) []reflect.Value {
 	val := in[0]
 	if val.Type() != t.elemType {
 		panic("Inserting wrong type")
 	}
 
-	t.insert1(val, nil, &t.root)
+	t.insert1(t.stored(val), nil, &t.root, nil)
 	return nil
 }
 
-func (t *Tree) insert1(val reflect.Value, p *Node, qp **Node) bool {
+func (t *Tree) insertIfAbsent(in []reflect.Value) []reflect.Value {
+	val := t.stored(in[0])
+	var q *Node
+	t.insert1(val, nil, &t.root, &q)
+	if q != nil {
+		return []reflect.Value{q.val, reflect.ValueOf(false)}
+	}
+	return []reflect.Value{val, reflect.ValueOf(true)}
+}
+
+// Package genericavl has a copy of the balancing code below,
+// from insert1 to rotate, which must be kept in step with it.
+
+// insert1 inserts val into the subtree *qp, whose parent is p,
+// and reports whether the height of the subtree increased. If
+// existing is not nil and an element equal to val is found, it
+// is stored in *existing and left in place instead of being
+// replaced, even in a multiset.
+func (t *Tree) insert1(val reflect.Value, p *Node, qp **Node, existing **Node) bool {
 	q := *qp
 	if q == nil {
 		t.size++
-		*qp = &Node{val: val, p: p}
+		*qp = &Node{val: val, p: p, size: 1}
+		t.linked(*qp)
+		if t.tracef != nil {
+			t.traceLink(*qp)
+		}
 		return true
 	}
 
 	c := t.cmp(val, q.val)
+	if t.tracef != nil {
+		t.tracef("compare %v with %v: %s", val, q.val, [...]string{"less", "equal", "greater"}[c+1])
+	}
 	if c == 0 {
-		q.val = val
-		return false
+		if existing != nil {
+			*existing = q
+			return false
+		}
+		if !t.multiset {
+			if t.onReplace != nil {
+				t.onReplace(q.val, val)
+			}
+			if t.tracef != nil {
+				t.tracef("replace %v with %v", q.val, val)
+			}
+			q.val = val
+			return false
+		}
+		// Equal elements go after the existing ones
+		// to keep them in insertion order.
+		c = 1
 	}
 
 	a := (c + 1) / 2
-	fix := t.insert1(val, q, &q.c[a])
+	fix := t.insert1(val, q, &q.c[a], existing)
+	q.fixSize()
 	if fix {
+		if t.tracef != nil {
+			traceFix(t.tracef, c, q)
+		}
 		return insertFix(c, qp)
 	}
-	return false
+	return false
+}
+
+func (t *Tree) traceLink(n *Node) {
+	switch {
+	case n.p == nil:
+		t.tracef("insert %v as the root", n.val)
+	case n.p.c[0] == n:
+		t.tracef("insert %v as the left child of %v", n.val, n.p.val)
+	default:
+		t.tracef("insert %v as the right child of %v", n.val, n.p.val)
+	}
+}
+
+// traceFix records what insertFix(c, &s) is about to do.
+func traceFix(tracef func(string, ...interface{}), c int8, s *Node) {
+	side := [...]string{"left", "", "right"}[c+1]
+	// Rotating with direction c lifts the child on side c.
+	rot := [...]string{"right", "", "left"}
+	switch {
+	case s.b == 0:
+		tracef("%v grew on the %s: balance 0 -> %d", s.val, side, c)
+	case s.b == -c:
+		tracef("%v grew on the %s: balance %d -> 0", s.val, side, s.b)
+	default:
+		r := s.c[(c+1)/2]
+		if r.b == c {
+			tracef("%v grew on the %s: balance %d -> %d, rotate %s at %v",
+				s.val, side, s.b, 2*c, rot[c+1], s.val)
+			break
+		}
+		p := r.c[(1-c)/2]
+		tracef("%v grew on the %s: balance %d -> %d, child %v has balance %d, rotate %s at %v then %s at %v making %v the subtree root",
+			s.val, side, s.b, 2*c, r.val, r.b, rot[1-c], r.val, rot[c+1], s.val, p.val)
+	}
 }
 
 func insertFix(c int8, t **Node) bool {
@@ -282,13 +2175,81 @@ func insertFix(c int8, t **Node) bool {
 }
 
 func (t *Tree) delete(in []reflect.Value) []reflect.Value {
-	val := in[0]
+	t.deleteVal(in[0])
+	return nil
+}
+
+func (t *Tree) deleteReporting(in []reflect.Value) []reflect.Value {
+	return []reflect.Value{reflect.ValueOf(t.deleteVal(in[0]))}
+}
+
+// deleteVal deletes the element that compares equal to val
+// and reports whether there was one.
+func (t *Tree) deleteVal(val reflect.Value) bool {
 	if val.Type() != t.elemType {
 		panic("Deleting wrong type")
 	}
 
+	size := t.size
 	t.delete1(val, &t.root)
-	return nil
+	t.maybeRebuild()
+	return t.size < size
+}
+
+// maybeRebuild rebuilds the tree if the AutoRebuild policy calls for it.
+func (t *Tree) maybeRebuild() {
+	if t.rebuildFrac > 0 && float64(t.deleted) > t.rebuildFrac*float64(t.size) {
+		t.Rebuild()
+	}
+}
+
+func (t *Tree) removeMin(in []reflect.Value) []reflect.Value {
+	return []reflect.Value{reflect.ValueOf(t.remove(0, deleteMin) != nil)}
+}
+
+func (t *Tree) removeMax(in []reflect.Value) []reflect.Value {
+	return []reflect.Value{reflect.ValueOf(t.remove(1, deleteMax) != nil)}
+}
+
+func (t *Tree) deleteMinFn(in []reflect.Value) []reflect.Value {
+	return t.found(t.remove(0, deleteMin))
+}
+
+func (t *Tree) deleteMaxFn(in []reflect.Value) []reflect.Value {
+	return t.found(t.remove(1, deleteMax))
+}
+
+func (t *Tree) dropMaxN(in []reflect.Value) []reflect.Value {
+	k := int(in[0].Int())
+	if k < 0 {
+		k = 0
+	}
+	n := t.DeleteRankRange(t.size-k, t.size)
+	return []reflect.Value{reflect.ValueOf(n)}
+}
+
+// remove deletes the node at the bottom of the tree in
+// direction d, which del unlinks, and returns it, or nil
+// if the tree is empty.
+func (t *Tree) remove(d int, del func(qp **Node, n **Node) bool) *Node {
+	if t.root == nil {
+		return nil
+	}
+	e := t.min
+	if d == 1 {
+		e = t.max
+	}
+	if t.onEvict != nil {
+		t.onEvict(e.val)
+	}
+	t.unlinking(e)
+	var n *Node
+	del(&t.root, &n)
+	n.unlink()
+	t.size--
+	t.deleted++
+	t.maybeRebuild()
+	return n
 }
 
 func (t *Tree) delete1(val reflect.Value, qp **Node) bool {
@@ -299,32 +2260,61 @@ func (t *Tree) delete1(val reflect.Value, qp **Node) bool {
 
 	c := t.cmp(val, q.val)
 	if c == 0 {
-		t.size--
-		if q.c[1] == nil {
-			if q.c[0] != nil {
-				q.c[0].p = q.p
-			}
-			*qp = q.c[0]
-			return true
+		if t.onEvict != nil {
+			t.onEvict(q.val)
 		}
-		fix := deleteMin(&q.c[1], &q.val)
-		if fix {
-			return deleteFix(-1, qp)
-		}
-		return false
+		t.size--
+		t.deleted++
+		t.unlinking(q)
+		defer q.unlink()
+		return excise(qp)
 	}
 	a := (c + 1) / 2
 	fix := t.delete1(val, &q.c[a])
+	q.fixSize()
 	if fix {
 		return deleteFix(-c, qp)
 	}
 	return false
 }
 
-func deleteMin(qp **Node, min *reflect.Value) bool {
+// excise removes the root of the subtree *qp and reports
+// whether the height of the subtree decreased. It leaves
+// the links of the removed node unchanged.
+func excise(qp **Node) bool {
+	q := *qp
+	if q.c[1] == nil {
+		if q.c[0] != nil {
+			q.c[0].p = q.p
+		}
+		*qp = q.c[0]
+		return true
+	}
+
+	// Replace q with its successor so that
+	// every other Node keeps its element.
+	var s *Node
+	fix := deleteMin(&q.c[1], &s)
+	s.c, s.p, s.b = q.c, q.p, q.b
+	for _, c := range s.c {
+		if c != nil {
+			c.p = s
+		}
+	}
+	s.fixSize()
+	*qp = s
+	if fix {
+		return deleteFix(-1, qp)
+	}
+	return false
+}
+
+// deleteMin removes the minimum node of the subtree *qp
+// and stores it in min.
+func deleteMin(qp **Node, min **Node) bool {
 	q := *qp
 	if q.c[0] == nil {
-		*min = q.val
+		*min = q
 		if q.c[1] != nil {
 			q.c[1].p = q.p
 		}
@@ -332,12 +2322,33 @@ func deleteMin(qp **Node, min *reflect.Value) bool {
 		return true
 	}
 	fix := deleteMin(&q.c[0], min)
+	q.fixSize()
 	if fix {
 		return deleteFix(1, qp)
 	}
 	return false
 }
 
+// deleteMax removes the maximum node of the subtree *qp
+// and stores it in max.
+func deleteMax(qp **Node, max **Node) bool {
+	q := *qp
+	if q.c[1] == nil {
+		*max = q
+		if q.c[0] != nil {
+			q.c[0].p = q.p
+		}
+		*qp = q.c[0]
+		return true
+	}
+	fix := deleteMax(&q.c[1], max)
+	q.fixSize()
+	if fix {
+		return deleteFix(-1, qp)
+	}
+	return false
+}
+
 func deleteFix(c int8, t **Node) bool {
 	s := *t
 	if s.b == 0 {
@@ -409,9 +2420,23 @@ func rotate(c int8, s *Node) *Node {
 	r.c[a^1] = s
 	r.p = s.p
 	s.p = r
+	s.fixSize()
+	r.fixSize()
 	return r
 }
 
+// sizeOf returns the number of nodes in the subtree rooted at n.
+func sizeOf(n *Node) int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *Node) fixSize() {
+	n.size = 1 + sizeOf(n.c[0]) + sizeOf(n.c[1])
+}
+
 func (t *Tree) value(in []reflect.Value) []reflect.Value {
 	n := in[0].Interface().(*Node)
 	return []reflect.Value{n.val}
@@ -428,13 +2453,509 @@ func (t *Tree) Root() *Node {
 }
 
 // Min returns the minimum ordered element of the tree.
+// It takes O(1) time.
 func (t *Tree) Min() *Node {
-	return t.bottom(0)
+	return t.min
 }
 
 // Max returns the maximum ordered element of the tree.
+// It takes O(1) time.
 func (t *Tree) Max() *Node {
-	return t.bottom(1)
+	return t.max
+}
+
+// Walk calls visit on each Node of the Tree in ascending
+// order until visit returns false. Visit must not modify
+// the Tree. Walk does not retain visit, so a function literal
+// passed to it is not allocated on the heap even if it
+// captures local variables.
+func (t *Tree) Walk(visit func(*Node) bool) {
+	// Keeping the path from the root on a stack saves the
+	// climbs back up through parent pointers that Next makes.
+	// An AVL tree of height 64 has over 10^13 nodes, so a
+	// fixed stack is big enough.
+	var stack [64]*Node
+	sp := 0
+	n := t.root
+	for {
+		for ; n != nil; n = n.c[0] {
+			stack[sp] = n
+			sp++
+		}
+		if sp == 0 {
+			return
+		}
+		sp--
+		n = stack[sp]
+		if !visit(n) {
+			return
+		}
+		n = n.c[1]
+	}
+}
+
+// WalkLeaves is like Walk but visits only the leaves of the
+// Tree, the nodes that have no children.
+func (t *Tree) WalkLeaves(visit func(*Node) bool) {
+	t.Walk(func(n *Node) bool {
+		if n.c[0] != nil || n.c[1] != nil {
+			return true
+		}
+		return visit(n)
+	})
+}
+
+// Intersects reports whether t and other hold any element in
+// common. It walks both trees in order and stops at the first
+// common element. Both trees must order their elements the
+// same way; Intersects uses the Compare method of t. It panics
+// if the trees hold elements of different types.
+func (t *Tree) Intersects(other *Tree) bool {
+	if t.elemType != other.elemType {
+		panic("Intersects of trees of different types")
+	}
+	a, b := t.Min(), other.Min()
+	for a != nil && b != nil {
+		switch t.cmp(a.val, b.val) {
+		case -1:
+			a = a.Next()
+		case 0:
+			return true
+		case 1:
+			b = b.Next()
+		}
+	}
+	return false
+}
+
+// IsConsistentWith reports whether the elements of t, in the
+// order of t, are also in order according to the Compare method
+// of other: no element compares greater under it than the one
+// after it. Other may order by a different Compare method and
+// its own elements are ignored, so IsConsistentWith can check
+// that one ordering refines another, for instance before using
+// a tree as a secondary index. It does not modify either tree
+// and takes O(n) time. It panics if the trees hold elements of
+// different types.
+func (t *Tree) IsConsistentWith(other *Tree) bool {
+	if t.elemType != other.elemType {
+		panic("IsConsistentWith of trees of different types")
+	}
+	for n := t.Min(); n != nil; n = n.Next() {
+		next := n.Next()
+		if next != nil && other.cmp(n.val, next.val) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Height returns the number of nodes on the longest path
+// from the root of the Tree to a leaf, or 0 if it is empty.
+// It follows the balance factors down the taller side of
+// each subtree so it takes O(log n) time.
+func (t *Tree) Height() int {
+	return height(t.root)
+}
+
+// CheckHeightBound returns an error if the height of the Tree
+// exceeds the maximum height of an AVL tree of its size, about
+// 1.44*log2(n+2). It takes O(log n) time so, unlike Validate,
+// it is cheap enough to call periodically as a sanity check.
+func (t *Tree) CheckHeightBound() error {
+	// An AVL tree of height h has at least
+	// minSize(h) = minSize(h-1) + minSize(h-2) + 1 nodes.
+	h := t.Height()
+	prev, min := 0, 1
+	for i := 1; i < h; i++ {
+		prev, min = min, min+prev+1
+	}
+	if h > 0 && min > t.size {
+		return fmt.Errorf("avl: tree of size %d has height %d", t.size, h)
+	}
+	return nil
+}
+
+// Validate checks the invariants of the Tree. The elements
+// must be in order according to Compare, every Node's parent
+// pointer, balance factor, and subtree size must agree with its
+// children, no two sibling subtrees may differ in height by more
+// than one, and Size must equal the number of nodes. Validate
+// returns an error describing the first violation found or nil.
+// It takes O(n) time.
+func (t *Tree) Validate() error {
+	if t.root != nil && t.root.p != nil {
+		return fmt.Errorf("avl: root %v has a parent", t.root.val)
+	}
+	if _, err := t.validate(t.root); err != nil {
+		return err
+	}
+	if n := sizeOf(t.root); n != t.size {
+		return fmt.Errorf("avl: tree has %d nodes but its size is %d", n, t.size)
+	}
+	if t.min != t.bottom(0) || t.max != t.bottom(1) {
+		return fmt.Errorf("avl: cached minimum or maximum is stale")
+	}
+	for n := t.Min(); n != nil; n = n.Next() {
+		next := n.Next()
+		if next == nil {
+			break
+		}
+		if c := t.cmp(n.val, next.val); c > 0 || c == 0 && !t.multiset {
+			return fmt.Errorf("avl: node %v is out of order with its successor %v", n.val, next.val)
+		}
+	}
+	return nil
+}
+
+// validate checks the subtree rooted at n and returns its height.
+func (t *Tree) validate(n *Node) (int, error) {
+	if n == nil {
+		return 0, nil
+	}
+	for _, c := range n.c {
+		if c != nil && c.p != n {
+			return 0, fmt.Errorf("avl: node %v has child %v with the wrong parent", n.val, c.val)
+		}
+	}
+	hl, err := t.validate(n.c[0])
+	if err != nil {
+		return 0, err
+	}
+	hr, err := t.validate(n.c[1])
+	if err != nil {
+		return 0, err
+	}
+	if d := hr - hl; d < -1 || d > 1 {
+		return 0, fmt.Errorf("avl: node %v is unbalanced: its subtree heights differ by %d", n.val, d)
+	}
+	if int(n.b) != hr-hl {
+		return 0, fmt.Errorf("avl: node %v has balance factor %d but its subtree heights differ by %d", n.val, n.b, hr-hl)
+	}
+	if size := 1 + sizeOf(n.c[0]) + sizeOf(n.c[1]); n.size != size {
+		return 0, fmt.Errorf("avl: node %v has size %d but its subtree holds %d nodes", n.val, n.size, size)
+	}
+	if hl > hr {
+		return hl + 1, nil
+	}
+	return hr + 1, nil
+}
+
+// WalkLevelOrder calls visit on each Node of the Tree in
+// breadth-first order, along with its depth, until visit
+// returns false. The root has depth 0 and the nodes at each
+// depth are visited in ascending order. It takes space
+// proportional to the width of the Tree.
+func (t *Tree) WalkLevelOrder(visit func(*Node, int) bool) {
+	if t.root == nil {
+		return
+	}
+	level := []*Node{t.root}
+	var next []*Node
+	for depth := 0; len(level) > 0; depth++ {
+		next = next[:0]
+		for _, n := range level {
+			if !visit(n, depth) {
+				return
+			}
+			for _, c := range n.c {
+				if c != nil {
+					next = append(next, c)
+				}
+			}
+		}
+		level, next = next, level
+	}
+}
+
+// WalkPreOrder calls visit on each Node of the Tree in
+// pre-order, each Node before its left and then its right
+// subtree, until visit returns false. A sequence of elements
+// in pre-order determines the shape of the Tree.
+func (t *Tree) WalkPreOrder(visit func(*Node) bool) {
+	preOrder(t.root, visit)
+}
+
+func preOrder(n *Node, visit func(*Node) bool) bool {
+	if n == nil {
+		return true
+	}
+	return visit(n) && preOrder(n.c[0], visit) && preOrder(n.c[1], visit)
+}
+
+// WalkPostOrder calls visit on each Node of the Tree in
+// post-order, each Node after its left and then its right
+// subtree, until visit returns false. Every Node is visited
+// after its children, so the root is visited last.
+func (t *Tree) WalkPostOrder(visit func(*Node) bool) {
+	postOrder(t.root, visit)
+}
+
+func postOrder(n *Node, visit func(*Node) bool) bool {
+	if n == nil {
+		return true
+	}
+	return postOrder(n.c[0], visit) && postOrder(n.c[1], visit) && visit(n)
+}
+
+// PathLength returns the internal path length of the Tree,
+// the sum of the depths of all of its nodes, where the root
+// has depth 0. It takes O(n) time and is meant for offline
+// analysis of the shape of the Tree.
+func (t *Tree) PathLength() int {
+	return pathLength(t.root, 0)
+}
+
+func pathLength(n *Node, depth int) int {
+	if n == nil {
+		return 0
+	}
+	return depth + pathLength(n.c[0], depth+1) + pathLength(n.c[1], depth+1)
+}
+
+// AverageDepth returns the mean depth of the nodes of the
+// Tree, or 0 if it is empty. Like PathLength it takes O(n) time.
+func (t *Tree) AverageDepth() float64 {
+	if t.size == 0 {
+		return 0
+	}
+	return float64(t.PathLength()) / float64(t.size)
+}
+
+// Clear deletes every element of the Tree, leaving it empty
+// and ready for reuse with the same Compare method, Options,
+// and function fields. Each Node is marked deleted and its
+// element passed to OnEvict, so Clear takes O(n) time.
+func (t *Tree) Clear() {
+	old := t.root
+	t.root, t.size, t.deleted = nil, 0, 0
+	t.min, t.max = nil, nil
+	if t.cache != nil {
+		t.cache = newLookupCache(t.cacheSize)
+	}
+	t.discard(old)
+}
+
+// Clone returns a copy of the Tree with the same shape, made of
+// new Nodes, that shares the Compare method and Options of t.
+// The elements themselves are shared, not passed to Copy, so
+// elements that are pointers point to the same values in both.
+// Otherwise the trees are independent: changing one does not
+// change the other. Like the Trees returned by SplitAt, the
+// clone has no tree struct, so it is used through its methods
+// and Nodes, or restored into t with Restore. Clone takes O(n)
+// time.
+func (t *Tree) Clone() *Tree {
+	c := t.empty()
+	c.root = cloneNode(t.root, nil)
+	c.size = t.size
+	c.resetExtremes()
+	return c
+}
+
+// Restore replaces the elements of t with those of c, which is
+// typically a snapshot of t taken by Clone, so that the
+// functions of the tree struct of t see the elements of c. The
+// Nodes of c are moved, not copied, leaving c empty; to restore
+// the same snapshot again, restore a clone of it. The old
+// elements of t are passed to OnEvict, and their Nodes are
+// marked deleted. Restore takes O(n) time for the old
+// elements. It panics if the trees hold elements of different
+// types.
+func (t *Tree) Restore(c *Tree) {
+	if t.elemType != c.elemType {
+		panic("Restore of a tree of a different type")
+	}
+	if t == c {
+		return
+	}
+	old := t.root
+	t.root, t.size, t.deleted = c.root, c.size, c.deleted
+	t.min, t.max = c.min, c.max
+	c.root, c.size, c.deleted = nil, 0, 0
+	c.min, c.max = nil, nil
+	if t.cache != nil {
+		t.cache = newLookupCache(t.cacheSize)
+	}
+	if c.cache != nil {
+		c.cache = newLookupCache(c.cacheSize)
+	}
+	t.discard(old)
+}
+
+// cloneNode returns a copy of the subtree rooted at n
+// with parent p.
+func cloneNode(n, p *Node) *Node {
+	if n == nil {
+		return nil
+	}
+	c := &Node{val: n.val, p: p, size: n.size, b: n.b, aux: n.aux}
+	c.c[0] = cloneNode(n.c[0], c)
+	c.c[1] = cloneNode(n.c[1], c)
+	return c
+}
+
+// Rebuild restructures the Tree so that it has the minimal
+// height possible for its size. It takes O(n) time. The
+// nodes themselves are reused so any *Node held by the
+// caller remains valid.
+func (t *Tree) Rebuild() {
+	nodes := make([]*Node, 0, t.size)
+	for n := t.Min(); n != nil; n = n.Next() {
+		nodes = append(nodes, n)
+	}
+	t.root, _ = build(nodes, nil)
+	t.deleted = 0
+}
+
+// ResortNode moves n, which must be in the Tree, to its
+// correct position after its element has been changed in a
+// way that affects how it compares, for instance through a
+// pointer returned by Lookup. If n is still in order with its
+// neighbors it is left where it is. Otherwise it is unlinked
+// by its rank, which does not depend on the order of the
+// elements, and inserted again, keeping its identity. If the
+// Tree is not a multiset and already holds an element equal to
+// the changed one, that element is replaced as by Insert and n
+// is deleted. ResortNode panics if n is not in the Tree.
+func (t *Tree) ResortNode(n *Node) {
+	if n.deleted || n.Root() != t.root {
+		panic("ResortNode of a Node not in the Tree")
+	}
+	prev, next := n.Prev(), n.Next()
+	if (prev == nil || t.follows(n.val, prev.val)) && (next == nil || t.follows(next.val, n.val)) {
+		return
+	}
+
+	var m *Node
+	t.unlinking(n)
+	deleteAt(&t.root, rankOf(n), &m)
+	if !t.multiset {
+		if q := t.find(n.val); q != nil {
+			if t.onReplace != nil {
+				t.onReplace(q.val, n.val)
+			}
+			q.val = n.val
+			n.unlink()
+			t.size--
+			t.deleted++
+			t.maybeRebuild()
+			return
+		}
+	}
+	n.c, n.p, n.b, n.size = [2]*Node{}, nil, 0, 1
+	t.insertNode(n, nil, &t.root)
+}
+
+// rankOf returns the 0-based rank of n in its tree.
+func rankOf(n *Node) int {
+	rank := sizeOf(n.c[0])
+	for ; n.p != nil; n = n.p {
+		if n.p.c[1] == n {
+			rank += sizeOf(n.p.c[0]) + 1
+		}
+	}
+	return rank
+}
+
+// deleteAt removes the node of rank k in the subtree *qp,
+// stores it in n, and reports whether the height of the
+// subtree decreased. It makes no comparisons.
+func deleteAt(qp **Node, k int, n **Node) bool {
+	q := *qp
+	r := sizeOf(q.c[0])
+	if k == r {
+		*n = q
+		return excise(qp)
+	}
+	c := int8(-1)
+	fix := false
+	if k < r {
+		fix = deleteAt(&q.c[0], k, n)
+	} else {
+		c = 1
+		fix = deleteAt(&q.c[1], k-r-1, n)
+	}
+	q.fixSize()
+	if fix {
+		return deleteFix(-c, qp)
+	}
+	return false
+}
+
+// insertNode links the unlinked node nn into the subtree
+// *qp, whose parent is p, keeping nodes with equal elements
+// in the order they were linked, and reports whether the
+// height of the subtree increased.
+func (t *Tree) insertNode(nn *Node, p *Node, qp **Node) bool {
+	q := *qp
+	if q == nil {
+		nn.p = p
+		*qp = nn
+		t.linked(nn)
+		return true
+	}
+	c := t.cmp(nn.val, q.val)
+	if c == 0 {
+		c = 1
+	}
+	fix := t.insertNode(nn, q, &q.c[(c+1)/2])
+	q.fixSize()
+	if fix {
+		return insertFix(c, qp)
+	}
+	return false
+}
+
+// build links the ordered nodes into a perfectly balanced
+// tree with parent p and returns its root and height.
+func build(nodes []*Node, p *Node) (*Node, int) {
+	if len(nodes) == 0 {
+		return nil, 0
+	}
+
+	m := len(nodes) / 2
+	n := nodes[m]
+	n.p = p
+	n.size = len(nodes)
+	var hl, hr int
+	n.c[0], hl = build(nodes[:m], n)
+	n.c[1], hr = build(nodes[m+1:], n)
+	n.b = int8(hr - hl)
+	if hl > hr {
+		return n, hl + 1
+	}
+	return n, hr + 1
+}
+
+// linked updates the cached minimum and maximum after the
+// leaf n has been linked into the tree.
+func (t *Tree) linked(n *Node) {
+	switch {
+	case n.p == nil:
+		t.min, t.max = n, n
+	case n.p == t.min && n.p.c[0] == n:
+		t.min = n
+	case n.p == t.max && n.p.c[1] == n:
+		t.max = n
+	}
+}
+
+// unlinking updates the cached minimum and maximum before n
+// is removed from the tree.
+func (t *Tree) unlinking(n *Node) {
+	if n == t.min {
+		t.min = n.Next()
+	}
+	if n == t.max {
+		t.max = n.Prev()
+	}
+}
+
+// resetExtremes recomputes the cached minimum and maximum
+// after the tree has been restructured in bulk.
+func (t *Tree) resetExtremes() {
+	t.min, t.max = t.bottom(0), t.bottom(1)
 }
 
 func (t *Tree) bottom(d int) *Node {
@@ -449,6 +2970,99 @@ func (t *Tree) bottom(d int) *Node {
 	return n
 }
 
+// Deleted reports whether n has been deleted from its Tree.
+// A deleted Node has no neighbors so Next and Prev return nil.
+// Every Node holds the same element for as long as it is in
+// the Tree, so a Node that has not been deleted still holds
+// the element it was created for.
+func (n *Node) Deleted() bool {
+	return n.deleted
+}
+
+// Root returns the root of the Tree holding n by following
+// parent pointers up from n. It returns n if n is the root
+// or has been deleted, and nil if n is nil.
+func (n *Node) Root() *Node {
+	if n == nil {
+		return nil
+	}
+	for n.p != nil {
+		n = n.p
+	}
+	return n
+}
+
+// Sibling returns the other child of the parent of n, or
+// nil if n is nil, n is the root, or its parent has only one
+// child.
+func (n *Node) Sibling() *Node {
+	if n == nil || n.p == nil {
+		return nil
+	}
+	if n.p.c[0] == n {
+		return n.p.c[1]
+	}
+	return n.p.c[0]
+}
+
+// Left returns the left child of n, or nil if it has none
+// or n is nil. Its elements all precede the element of n.
+func (n *Node) Left() *Node {
+	if n == nil {
+		return nil
+	}
+	return n.c[0]
+}
+
+// Right returns the right child of n, or nil if it has none
+// or n is nil. Its elements all follow the element of n.
+func (n *Node) Right() *Node {
+	if n == nil {
+		return nil
+	}
+	return n.c[1]
+}
+
+// Parent returns the parent of n, or nil if n is the root
+// or nil.
+func (n *Node) Parent() *Node {
+	if n == nil {
+		return nil
+	}
+	return n.p
+}
+
+// Height returns the number of nodes on the longest path from
+// n down to a leaf of its subtree, 1 for a leaf and 0 for a
+// nil Node. Like Tree.Height it follows the balance factors
+// down the taller side, so it takes O(log n) time.
+func (n *Node) Height() int {
+	return height(n)
+}
+
+// Aux returns the value last passed to SetAux, or nil.
+func (n *Node) Aux() interface{} {
+	return n.aux
+}
+
+// SetAux stores x in n. The Tree never reads or changes it,
+// and since a Node keeps its element for as long as it is in
+// the Tree, x stays with the element through rotations and
+// deletions of other elements. It is meant for per-element
+// state such as marks, colors or the bookkeeping of a graph
+// algorithm layered on the Tree, which would otherwise need a
+// map keyed by Node. Every Node has room for it whether or
+// not it is used, which costs 16 bytes per Node.
+func (n *Node) SetAux(x interface{}) {
+	n.aux = x
+}
+
+func (n *Node) unlink() {
+	n.c = [2]*Node{}
+	n.p = nil
+	n.deleted = true
+}
+
 // Prev returns the previous Node in an in-order walk
 // of the Tree holding the Node n.
 func (n *Node) Prev() *Node {
@@ -1,7 +1,13 @@
 package avl_test
 
 import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/bits"
 	"math/rand"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -35,8 +41,77 @@ func TestInsertOrdered(t *testing.T) {
 	tree.checkOrdered(t)
 }
 
-func newRandIntTree(n, randMax int, t *testing.T) *IntTree {
-	var tree IntTree
+// FullIntTree is an IntTree with the other functions Make
+// provides that the tests use.
+type FullIntTree struct {
+	*avl.Tree
+	Insert func(int)
+	Delete func(int)
+	Lookup func(int) (int, bool)
+	Value  func(*avl.Node) int
+
+	LookupRank func(int) (int, int, bool)
+	Fold       func(interface{}, func(interface{}, int) interface{}) interface{}
+	RangeFrom  func(int, func(*avl.Node) bool)
+	RangeTo    func(int, func(*avl.Node) bool)
+	Move       func(int, int) bool
+
+	LookupDepth   func(int, int) (int, bool, bool)
+	SelectFromMax func(int) (int, bool)
+	AppendSorted  func([]int) error
+	TraceInsert   func(int) []string
+	SymmetricDiff func(a, b *avl.Tree) ([]int, []int)
+	ForEachFrom   func(int, func(int) bool)
+
+	CountWhileOrdered func(func(int) bool) int
+	LowerBound        func(int) *avl.Node
+	UpperBound        func(int) *avl.Node
+	InsertSeq         func(func(func(int) bool))
+	GetOr             func(int, int) int
+	ParallelBuild     func([]int, int) error
+	RemoveMin         func() bool
+	RemoveMax         func() bool
+
+	FirstDifference func(a, b *avl.Tree) (int, int, int, bool)
+	Clamp           func(int) (int, bool)
+	HasRange        func(int, int) bool
+	LookupMany      func([]int) ([]int, []bool)
+	ReplaceAll      func([]int) int
+	Neighbors       func(int) (int, bool, int, bool)
+	RangeSeq        func(lo, hi int, ascending bool) func(func(int) bool)
+	LookupNode      func(int) (*avl.Node, int, bool)
+	DropMaxN        func(k int) int
+	Zip             func(a, b *avl.Tree, visit func(v int, fromA bool) bool)
+	SampleK         func(k int, r *rand.Rand) []int
+	WalkPairs       func(visit func(prev, cur int, hasPrev bool) bool)
+	Floor           func(int) (int, bool)
+	Ceiling         func(int) (int, bool)
+	Higher          func(int) (int, bool)
+	Lower           func(int) (int, bool)
+	Rank            func(int) int
+	Select          func(k int) (int, bool)
+	Range           func(lo, hi int, visit func(int) bool)
+	Count           func(lo, hi int) int
+	DeleteMin       func() (int, bool)
+	DeleteMax       func() (int, bool)
+	InsertIfAbsent  func(int) (int, bool)
+	Contains        func(int) bool
+	ForEach         func(visit func(int) bool)
+	ForEachReverse  func(visit func(int) bool)
+	Keys            func() []int
+	Build           func(sorted []int) error
+}
+
+func (FullIntTree) Compare(a, b int) int {
+	return IntTree{}.Compare(a, b)
+}
+
+func (tree *FullIntTree) SetTree(t *avl.Tree) {
+	tree.Tree = t
+}
+
+func newRandIntTree(n, randMax int, t *testing.T) *FullIntTree {
+	var tree FullIntTree
 	if err := avl.Make(&tree); err != nil {
 		t.Error(err)
 	}
@@ -47,7 +122,7 @@ func newRandIntTree(n, randMax int, t *testing.T) *IntTree {
 	return &tree
 }
 
-func (tree *IntTree) checkOrdered(t *testing.T) {
+func (tree *FullIntTree) checkOrdered(t *testing.T) {
 	n := tree.Min()
 	for next := n.Next(); next != nil; next = n.Next() {
 		t.Logf("Value in node is %d\n", tree.Value(n))
@@ -57,3 +132,2818 @@ func (tree *IntTree) checkOrdered(t *testing.T) {
 		n = next
 	}
 }
+
+func TestRebuild(t *testing.T) {
+	tree := newRandIntTree(nNodes, randMax, t)
+	size := tree.Size()
+	tree.Rebuild()
+	if tree.Size() != size {
+		t.Errorf("Rebuild changed size from %d to %d", size, tree.Size())
+	}
+	tree.checkOrdered(t)
+	checkPerfect(t, tree.Tree)
+}
+
+// checkPerfect reports an error unless the tree has the
+// minimal height for its size and the shape Rebuild gives it,
+// in which the subtrees of each Node differ in size by at
+// most one.
+func checkPerfect(t *testing.T, tree *avl.Tree) {
+	t.Helper()
+	if h, want := tree.Height(), bits.Len(uint(tree.Size())); h != want {
+		t.Errorf("Height is %d, want the minimal %d", h, want)
+	}
+	var count func(n *avl.Node) int
+	count = func(n *avl.Node) int {
+		if n == nil {
+			return 0
+		}
+		l, r := count(n.Left()), count(n.Right())
+		if l-r > 1 || r-l > 1 {
+			t.Errorf("subtrees of a Node have %d and %d elements", l, r)
+		}
+		return l + r + 1
+	}
+	count(tree.Root())
+}
+
+func TestAutoRebuild(t *testing.T) {
+	var tree FullIntTree
+	if err := avl.Make(&tree, avl.AutoRebuild(0.5)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < nNodes; i++ {
+		tree.Insert(i)
+	}
+	// Deleting the smallest third of the elements leaves the
+	// tree lopsided. The tree is rebuilt by the deletion that
+	// makes the deleted elements outnumber half of those left,
+	// the 334th, after which it is perfectly balanced.
+	const ndel = nNodes/3 + 1
+	for i := 0; i < ndel; i++ {
+		tree.Delete(i)
+	}
+	if tree.Size() != nNodes-ndel {
+		t.Errorf("Size is %d, want %d", tree.Size(), nNodes-ndel)
+	}
+	tree.checkOrdered(t)
+	checkPerfect(t, tree.Tree)
+}
+
+func TestLookupRank(t *testing.T) {
+	tree := newRandIntTree(nNodes, randMax, t)
+	for i := 0; i < nDels; i++ {
+		tree.Delete(rng.Intn(randMax))
+	}
+	rank := 0
+	for n := tree.Min(); n != nil; n = n.Next() {
+		v, r, ok := tree.LookupRank(tree.Value(n))
+		if !ok || v != tree.Value(n) || r != rank {
+			t.Errorf("LookupRank(%d) = %d, %d, %v; want %d, %d, true", tree.Value(n), v, r, ok, tree.Value(n), rank)
+		}
+		rank++
+	}
+	if _, r, ok := tree.LookupRank(-1); ok || r != -1 {
+		t.Errorf("LookupRank(-1) = _, %d, %v; want -1, false", r, ok)
+	}
+}
+
+type pair struct {
+	key, val int
+}
+
+type PairMultiset struct {
+	*avl.Tree
+	Insert     func(pair)
+	Delete     func(pair)
+	EqualRange func(pair) []pair
+	ReplaceAll func([]pair) int
+
+	InsertIfAbsent func(pair) (pair, bool)
+	GetOrInsert    func(pair) (pair, bool)
+}
+
+func (PairMultiset) Compare(a, b pair) int {
+	return a.key - b.key
+}
+
+func (m *PairMultiset) SetTree(t *avl.Tree) {
+	m.Tree = t
+}
+
+func TestMultisetRequired(t *testing.T) {
+	var m PairMultiset
+	if err := avl.Make(&m); err == nil {
+		t.Error("EqualRange made without the Multiset option")
+	}
+}
+
+func TestEqualRange(t *testing.T) {
+	var m PairMultiset
+	if err := avl.Make(&m, avl.Multiset()); err != nil {
+		t.Fatal(err)
+	}
+	const nKeys = 10
+	for i := 0; i < nNodes; i++ {
+		m.Insert(pair{rng.Intn(nKeys), i})
+	}
+	if m.Size() != nNodes {
+		t.Errorf("Size is %d, want %d", m.Size(), nNodes)
+	}
+	total := 0
+	for k := 0; k < nKeys; k++ {
+		ps := m.EqualRange(pair{key: k})
+		for i, p := range ps {
+			if p.key != k {
+				t.Errorf("EqualRange(%d) returned key %d", k, p.key)
+			}
+			if i > 0 && p.val <= ps[i-1].val {
+				t.Errorf("EqualRange(%d) not in insertion order: %d after %d", k, p.val, ps[i-1].val)
+			}
+		}
+		total += len(ps)
+	}
+	if total != nNodes {
+		t.Errorf("EqualRange found %d elements, want %d", total, nNodes)
+	}
+	if ps := m.EqualRange(pair{key: nKeys}); len(ps) != 0 {
+		t.Errorf("EqualRange(%d) = %v, want none", nKeys, ps)
+	}
+}
+
+func TestFold(t *testing.T) {
+	tree := newRandIntTree(nNodes, randMax, t)
+	sum := 0
+	for n := tree.Min(); n != nil; n = n.Next() {
+		sum += tree.Value(n)
+	}
+	acc := tree.Fold(0, func(acc interface{}, v int) interface{} {
+		return acc.(int) + v
+	})
+	if acc.(int) != sum {
+		t.Errorf("Fold sum is %d, want %d", acc, sum)
+	}
+
+	var empty FullIntTree
+	avl.Make(&empty)
+	if acc := empty.Fold(nil, nil); acc != nil {
+		t.Errorf("Fold of empty tree is %v, want nil", acc)
+	}
+}
+
+func TestWalkLeaves(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 7; i++ {
+		tree.Insert(i)
+	}
+	var leaves []int
+	tree.WalkLeaves(func(n *avl.Node) bool {
+		leaves = append(leaves, tree.Value(n))
+		return true
+	})
+	want := []int{0, 2, 4, 6}
+	if len(leaves) != len(want) {
+		t.Fatalf("WalkLeaves visited %v, want %v", leaves, want)
+	}
+	for i := range want {
+		if leaves[i] != want[i] {
+			t.Fatalf("WalkLeaves visited %v, want %v", leaves, want)
+		}
+	}
+
+	leaves = leaves[:0]
+	tree.WalkLeaves(func(n *avl.Node) bool {
+		leaves = append(leaves, tree.Value(n))
+		return len(leaves) < 2
+	})
+	if len(leaves) != 2 {
+		t.Errorf("WalkLeaves did not stop early: visited %v", leaves)
+	}
+}
+
+func TestPathLength(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if pl, ad := tree.PathLength(), tree.AverageDepth(); pl != 0 || ad != 0 {
+		t.Errorf("empty tree has PathLength %d and AverageDepth %g", pl, ad)
+	}
+	for i := 0; i < 7; i++ {
+		tree.Insert(i)
+	}
+	if pl := tree.PathLength(); pl != 10 {
+		t.Errorf("PathLength is %d, want 10", pl)
+	}
+	if ad := tree.AverageDepth(); ad != 10.0/7 {
+		t.Errorf("AverageDepth is %g, want %g", ad, 10.0/7)
+	}
+}
+
+func TestRangeFromTo(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 20; i += 2 {
+		tree.Insert(i)
+	}
+	collect := func(rng func(int, func(*avl.Node) bool), k, limit int) []int {
+		var vals []int
+		rng(k, func(n *avl.Node) bool {
+			vals = append(vals, tree.Value(n))
+			return len(vals) < limit
+		})
+		return vals
+	}
+	tests := []struct {
+		name  string
+		rng   func(int, func(*avl.Node) bool)
+		k     int
+		limit int
+		want  []int
+	}{
+		{"RangeFrom", tree.RangeFrom, 13, 100, []int{14, 16, 18}},
+		{"RangeFrom", tree.RangeFrom, 14, 100, []int{14, 16, 18}},
+		{"RangeFrom", tree.RangeFrom, -5, 2, []int{0, 2}},
+		{"RangeFrom", tree.RangeFrom, 19, 100, nil},
+		{"RangeTo", tree.RangeTo, 5, 100, []int{0, 2, 4}},
+		{"RangeTo", tree.RangeTo, 4, 100, []int{0, 2, 4}},
+		{"RangeTo", tree.RangeTo, 30, 1, []int{0}},
+		{"RangeTo", tree.RangeTo, -1, 100, nil},
+	}
+	for _, test := range tests {
+		got := collect(test.rng, test.k, test.limit)
+		if !equalInts(got, test.want) {
+			t.Errorf("%s(%d) visited %v, want %v", test.name, test.k, got, test.want)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type FloatTree struct {
+	*avl.Tree
+	Insert func(float64)
+	Lookup func(float64) (float64, bool)
+}
+
+func (FloatTree) Compare(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	default:
+		return 0
+	case a > b:
+		return 1
+	}
+}
+
+func (tree *FloatTree) SetTree(t *avl.Tree) {
+	tree.Tree = t
+}
+
+func TestNaNMerges(t *testing.T) {
+	var tree FloatTree
+	avl.Make(&tree)
+	for _, f := range []float64{1, 2, 3} {
+		tree.Insert(f)
+	}
+	tree.Insert(math.NaN())
+	if tree.Size() != 3 {
+		t.Errorf("Size is %d after inserting NaN, want 3", tree.Size())
+	}
+	// The NaN replaced the root, 2, and now compares equal to it.
+	if v, _ := tree.Lookup(2); !math.IsNaN(v) {
+		t.Errorf("Lookup(2) = %g, want NaN", v)
+	}
+}
+
+func TestRejectNaN(t *testing.T) {
+	var tree FloatTree
+	if err := avl.Make(&tree, avl.RejectNaN()); err != nil {
+		t.Fatal(err)
+	}
+	tree.Insert(1)
+	for name, fn := range map[string]func(){
+		"Insert": func() { tree.Insert(math.NaN()) },
+		"Lookup": func() { tree.Lookup(math.NaN()) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s of NaN did not panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+	if _, ok := tree.Lookup(1); !ok || tree.Size() != 1 {
+		t.Error("rejected NaN modified the tree")
+	}
+}
+
+func TestMove(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 100; i += 10 {
+		tree.Insert(i)
+	}
+	tests := []struct {
+		old, new int
+		inPlace  bool
+	}{
+		{50, 55, true},
+		{55, 45, true},
+		{45, 65, false},
+		{0, -10, true},
+		{90, 95, true},
+		{95, 5, false},
+		{1000, 1001, false},
+	}
+	for _, test := range tests {
+		if got := tree.Move(test.old, test.new); got != test.inPlace {
+			t.Errorf("Move(%d, %d) = %v, want %v", test.old, test.new, got, test.inPlace)
+		}
+		if _, ok := tree.Lookup(test.old); ok {
+			t.Errorf("Move(%d, %d) left %d in the tree", test.old, test.new, test.old)
+		}
+		if _, ok := tree.Lookup(test.new); !ok {
+			t.Errorf("Move(%d, %d) did not store %d", test.old, test.new, test.new)
+		}
+		tree.checkOrdered(t)
+	}
+	// Moving the absent 1000 inserted 1001.
+	if tree.Size() != 11 {
+		t.Errorf("Size is %d, want 11", tree.Size())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tree := newRandIntTree(nNodes, randMax, t)
+	for i := 0; i < nDels; i++ {
+		tree.Delete(rng.Intn(randMax))
+		if err := tree.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLookupDepth(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 7; i++ {
+		tree.Insert(i)
+	}
+	tests := []struct {
+		key, maxDepth int
+		found, gaveUp bool
+	}{
+		{3, 1, true, false},
+		{0, 2, false, true},
+		{0, 3, true, false},
+		{7, 2, false, true},
+		{7, 3, false, false},
+		{3, 0, false, true},
+	}
+	for _, test := range tests {
+		v, found, gaveUp := tree.LookupDepth(test.key, test.maxDepth)
+		if found != test.found || gaveUp != test.gaveUp || found && v != test.key {
+			t.Errorf("LookupDepth(%d, %d) = %d, %v, %v; want found %v, gave up %v",
+				test.key, test.maxDepth, v, found, gaveUp, test.found, test.gaveUp)
+		}
+	}
+}
+
+func TestWalkLevelOrder(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	tree.WalkLevelOrder(func(*avl.Node, int) bool {
+		t.Error("WalkLevelOrder visited a node of an empty tree")
+		return true
+	})
+	for i := 0; i < 7; i++ {
+		tree.Insert(i)
+	}
+	var vals, depths []int
+	tree.WalkLevelOrder(func(n *avl.Node, depth int) bool {
+		vals = append(vals, tree.Value(n))
+		depths = append(depths, depth)
+		return true
+	})
+	if want := []int{3, 1, 5, 0, 2, 4, 6}; !equalInts(vals, want) {
+		t.Errorf("WalkLevelOrder visited %v, want %v", vals, want)
+	}
+	if want := []int{0, 1, 1, 2, 2, 2, 2}; !equalInts(depths, want) {
+		t.Errorf("WalkLevelOrder depths are %v, want %v", depths, want)
+	}
+
+	vals = vals[:0]
+	tree.WalkLevelOrder(func(n *avl.Node, depth int) bool {
+		vals = append(vals, tree.Value(n))
+		return depth < 1
+	})
+	if want := []int{3, 1}; !equalInts(vals, want) {
+		t.Errorf("WalkLevelOrder did not stop early: visited %v, want %v", vals, want)
+	}
+}
+
+type PoolTree struct {
+	*avl.Tree
+	Insert func(*pair)
+	Delete func(*pair)
+
+	evicted, replaced []*pair
+}
+
+func (*PoolTree) Compare(a, b *pair) int {
+	return a.key - b.key
+}
+
+func (m *PoolTree) SetTree(t *avl.Tree) {
+	m.Tree = t
+}
+
+func (m *PoolTree) OnEvict(p *pair) {
+	m.evicted = append(m.evicted, p)
+}
+
+func (m *PoolTree) OnReplace(old, new *pair) {
+	m.replaced = append(m.replaced, old)
+}
+
+func TestEvictHooks(t *testing.T) {
+	var m PoolTree
+	if err := avl.Make(&m); err != nil {
+		t.Fatal(err)
+	}
+	var ps []*pair
+	for i := 0; i < 100; i++ {
+		p := &pair{key: i}
+		ps = append(ps, p)
+		m.Insert(p)
+	}
+	m.Insert(&pair{key: 10})
+	if len(m.replaced) != 1 || m.replaced[0] != ps[10] || len(m.evicted) != 0 {
+		t.Fatalf("overwrite replaced %v and evicted %v", m.replaced, m.evicted)
+	}
+	for _, i := range rng.Perm(100)[:50] {
+		m.Delete(&pair{key: i})
+		if i == 10 {
+			continue
+		}
+		if n := len(m.evicted); n == 0 || m.evicted[n-1] != ps[i] {
+			t.Fatalf("Delete(%d) did not evict %v", i, ps[i])
+		}
+	}
+	if len(m.evicted) != 50 {
+		t.Errorf("evicted %d elements, want 50", len(m.evicted))
+	}
+	m.Delete(&pair{key: 1000})
+	if len(m.evicted) != 50 {
+		t.Error("deleting a missing element evicted something")
+	}
+}
+
+func TestIntersects(t *testing.T) {
+	var evens, odds, threes FullIntTree
+	avl.Make(&evens)
+	avl.Make(&odds)
+	avl.Make(&threes)
+	for i := 0; i < 100; i++ {
+		switch {
+		case i%2 == 0:
+			evens.Insert(i)
+		default:
+			odds.Insert(i)
+		}
+		if i%3 == 0 {
+			threes.Insert(i)
+		}
+	}
+	if evens.Intersects(odds.Tree) || odds.Intersects(evens.Tree) {
+		t.Error("evens and odds intersect")
+	}
+	if !evens.Intersects(threes.Tree) || !threes.Intersects(odds.Tree) {
+		t.Error("multiples of three do not intersect evens and odds")
+	}
+	var empty FullIntTree
+	avl.Make(&empty)
+	if empty.Intersects(evens.Tree) || evens.Intersects(empty.Tree) {
+		t.Error("empty tree intersects evens")
+	}
+}
+
+// DecadeTree orders ints by their tens digit only.
+type DecadeTree struct {
+	*avl.Tree
+	Insert func(int)
+}
+
+func (DecadeTree) Compare(a, b int) int {
+	return IntTree{}.Compare(a/10, b/10)
+}
+
+func (tree *DecadeTree) SetTree(t *avl.Tree) {
+	tree.Tree = t
+}
+
+func TestIsConsistentWith(t *testing.T) {
+	var ints FullIntTree
+	var decades DecadeTree
+	avl.Make(&ints)
+	avl.Make(&decades, avl.Multiset())
+	for _, v := range []int{15, 12, 31, 7, 24, 29} {
+		ints.Insert(v)
+		decades.Insert(v)
+	}
+	if !ints.IsConsistentWith(decades.Tree) {
+		t.Error("ascending ints are not in order by decade")
+	}
+	if decades.IsConsistentWith(ints.Tree) {
+		t.Error("ints in order by decade only are in ascending order")
+	}
+	if !ints.IsConsistentWith(ints.Tree) {
+		t.Error("tree is not consistent with itself")
+	}
+	var floats FloatTree
+	avl.Make(&floats)
+	defer func() {
+		if recover() == nil {
+			t.Error("IsConsistentWith of trees of different types did not panic")
+		}
+	}()
+	ints.IsConsistentWith(floats.Tree)
+}
+
+func TestMemoizeCompare(t *testing.T) {
+	var tree FullIntTree
+	if err := avl.Make(&tree, avl.MemoizeCompare(16)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < nNodes; i++ {
+		tree.Insert(rng.Intn(randMax))
+	}
+	for i := 0; i < nDels; i++ {
+		tree.Delete(rng.Intn(randMax))
+	}
+	if err := tree.Validate(); err != nil {
+		t.Error(err)
+	}
+	tree.checkOrdered(t)
+}
+
+type SliceTree struct {
+	Insert func([]int)
+}
+
+func (SliceTree) Compare(a, b []int) int {
+	return len(a) - len(b)
+}
+
+func TestMemoizeCompareIncomparable(t *testing.T) {
+	var tree SliceTree
+	if err := avl.Make(&tree, avl.MemoizeCompare(16)); err == nil {
+		t.Error("memoized comparisons of slices")
+	}
+}
+
+func TestMemoizeCompareNaN(t *testing.T) {
+	const size = 4
+	var tree FloatTree
+	if err := avl.Make(&tree, avl.MemoizeCompare(size)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		tree.Insert(float64(i))
+	}
+	for i := 0; i < 100; i++ {
+		tree.Lookup(math.NaN())
+	}
+	if n := tree.MemoLen(); n > size {
+		t.Errorf("memo of size %d holds %d comparisons", size, n)
+	}
+}
+
+func TestMemoizeCompareDynamic(t *testing.T) {
+	var tree AnyTree
+	if err := avl.Make(&tree, avl.MemoizeCompare(16)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		tree.Insert(i)
+	}
+	// Comparisons of ints are memoized, but those of
+	// slices, which cannot be hashed, are not.
+	tree.Insert([]int{10})
+	for i := 0; i < 2; i++ {
+		if v, ok := tree.Lookup(3); !ok || v != 3 {
+			t.Errorf("Lookup(3) = %v, %v", v, ok)
+		}
+		if v, ok := tree.Lookup([]int{4}); !ok || v != 4 {
+			t.Errorf("Lookup([]int{4}) = %v, %v", v, ok)
+		}
+	}
+	if err := tree.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSelectFromMax(t *testing.T) {
+	tree := newRandIntTree(nNodes, randMax, t)
+	k := 0
+	for n := tree.Max(); n != nil; n = n.Prev() {
+		if v, ok := tree.SelectFromMax(k); !ok || v != tree.Value(n) {
+			t.Errorf("SelectFromMax(%d) = %d, %v; want %d, true", k, v, ok, tree.Value(n))
+		}
+		k++
+	}
+	for _, k := range []int{-1, tree.Size()} {
+		if _, ok := tree.SelectFromMax(k); ok {
+			t.Errorf("SelectFromMax(%d) found an element", k)
+		}
+	}
+}
+
+func TestHeight(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if h := tree.Height(); h != 0 {
+		t.Errorf("empty tree has height %d", h)
+	}
+	for i := 0; i < 7; i++ {
+		tree.Insert(i)
+	}
+	if h := tree.Height(); h != 3 {
+		t.Errorf("Height is %d, want 3", h)
+	}
+	tree.Insert(7)
+	if h := tree.Height(); h != 4 {
+		t.Errorf("Height is %d, want 4", h)
+	}
+}
+
+func TestCheckHeightBound(t *testing.T) {
+	tree := newRandIntTree(nNodes, randMax, t)
+	for i := 0; i < nDels; i++ {
+		tree.Delete(rng.Intn(randMax))
+		if err := tree.CheckHeightBound(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+type PtrTree struct {
+	*avl.Tree
+	Insert     func(*pair)
+	Delete     func(*pair)
+	Lookup     func(*pair) (*pair, bool)
+	LookupRank func(*pair) (*pair, int, bool)
+	Move       func(old, new *pair) bool
+	RangeFrom  func(*pair, func(*avl.Node) bool)
+}
+
+func (PtrTree) Compare(a, b *pair) int {
+	return a.key - b.key
+}
+
+func (tree *PtrTree) SetTree(t *avl.Tree) {
+	tree.Tree = t
+}
+
+func TestRejectNil(t *testing.T) {
+	var tree PtrTree
+	if err := avl.Make(&tree, avl.RejectNil()); err != nil {
+		t.Fatal(err)
+	}
+	tree.Insert(&pair{key: 1})
+	for name, fn := range map[string]func(){
+		"Insert":     func() { tree.Insert(nil) },
+		"Delete":     func() { tree.Delete(nil) },
+		"Lookup":     func() { tree.Lookup(nil) },
+		"LookupRank": func() { tree.LookupRank(nil) },
+		"Move":       func() { tree.Move(&pair{key: 1}, nil) },
+		"RangeFrom":  func() { tree.RangeFrom(nil, func(*avl.Node) bool { return true }) },
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r != "avl: nil element" {
+					t.Errorf("%s of nil panicked with %v", name, r)
+				}
+			}()
+			fn()
+		}()
+	}
+	if _, ok := tree.Lookup(&pair{key: 1}); !ok || tree.Size() != 1 {
+		t.Error("rejected nil modified the tree")
+	}
+}
+
+// AnyTree holds interface{} elements, which must be ints or
+// []ints, which compare as their first element.
+type AnyTree struct {
+	*avl.Tree
+	Insert func(interface{})
+	Lookup func(interface{}) (interface{}, bool)
+	Fold   func(interface{}, func(interface{}, interface{}) interface{}) interface{}
+}
+
+func (AnyTree) Compare(a, b interface{}) int {
+	return anyKey(a) - anyKey(b)
+}
+
+func anyKey(v interface{}) int {
+	if s, ok := v.([]int); ok {
+		return s[0]
+	}
+	return v.(int)
+}
+
+func (tree *AnyTree) SetTree(t *avl.Tree) {
+	tree.Tree = t
+}
+
+func TestRejectNilFold(t *testing.T) {
+	var tree AnyTree
+	if err := avl.Make(&tree, avl.RejectNil()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		tree.Insert(i)
+	}
+	// The accumulator of Fold has the element type but is not
+	// an element, so a nil accumulator is allowed.
+	acc := tree.Fold(nil, func(acc, v interface{}) interface{} {
+		if acc == nil {
+			return v
+		}
+		return acc.(int) + v.(int)
+	})
+	if acc != 6 {
+		t.Errorf("Fold = %v, want 6", acc)
+	}
+}
+
+func TestAppendSorted(t *testing.T) {
+	for _, sizes := range [][2]int{{0, 0}, {0, 5}, {1, 1}, {3, 1000}, {1000, 3}, {100, 100}, {1000, 1}} {
+		var tree FullIntTree
+		avl.Make(&tree)
+		for i := 0; i < sizes[0]; i++ {
+			tree.Insert(i)
+		}
+		vals := make([]int, sizes[1])
+		for i := range vals {
+			vals[i] = sizes[0] + i
+		}
+		if err := tree.AppendSorted(vals); err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("after appending %d to %d elements: %v", sizes[1], sizes[0], err)
+		}
+		if n := sizes[0] + sizes[1]; tree.Size() != n {
+			t.Errorf("Size is %d, want %d", tree.Size(), n)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		tree := newRandIntTree(rng.Intn(300), randMax, t)
+		vals := make([]int, rng.Intn(300))
+		for j := range vals {
+			vals[j] = randMax + j
+		}
+		size := tree.Size()
+		if err := tree.AppendSorted(vals); err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("after appending %d to %d elements: %v", len(vals), size, err)
+		}
+	}
+
+	var tree FullIntTree
+	avl.Make(&tree)
+	tree.Insert(10)
+	for _, vals := range [][]int{{10}, {11, 13, 12}, {5}} {
+		if err := tree.AppendSorted(vals); err == nil {
+			t.Errorf("AppendSorted(%v) succeeded", vals)
+		}
+	}
+	if tree.Size() != 1 {
+		t.Error("failed AppendSorted modified the tree")
+	}
+}
+
+func TestSplitAt(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		tree := newRandIntTree(rng.Intn(300), randMax, t)
+		size := tree.Size()
+		k := rng.Intn(size+20) - 10
+		l, r := tree.SplitAt(k)
+		if tree.Size() != 0 || tree.Root() != nil {
+			t.Error("SplitAt did not empty the tree")
+		}
+		switch {
+		case k < 0:
+			k = 0
+		case k > size:
+			k = size
+		}
+		if l.Size() != k || r.Size() != size-k {
+			t.Fatalf("SplitAt(%d) of %d elements gave sizes %d and %d", k, size, l.Size(), r.Size())
+		}
+		for _, half := range []*avl.Tree{l, r} {
+			if err := half.Validate(); err != nil {
+				t.Fatalf("SplitAt(%d) of %d elements: %v", k, size, err)
+			}
+		}
+		if l.Size() > 0 && r.Size() > 0 && tree.Value(l.Max()) >= tree.Value(r.Min()) {
+			t.Fatalf("SplitAt(%d): left max %d is not less than right min %d", k, tree.Value(l.Max()), tree.Value(r.Min()))
+		}
+	}
+}
+
+func TestDeleted(t *testing.T) {
+	tree := newRandIntTree(nNodes, randMax, t)
+	var nodes []*avl.Node
+	tree.Walk(func(n *avl.Node) bool {
+		nodes = append(nodes, n)
+		return true
+	})
+	vals := make([]int, len(nodes))
+	for i, n := range nodes {
+		vals[i] = tree.Value(n)
+	}
+	deleted := make(map[int]bool)
+	for _, i := range rng.Perm(len(nodes))[:len(nodes)/2] {
+		tree.Delete(vals[i])
+		deleted[vals[i]] = true
+	}
+	for i, n := range nodes {
+		if n.Deleted() != deleted[vals[i]] {
+			t.Errorf("node of %d has Deleted %v, want %v", vals[i], n.Deleted(), deleted[vals[i]])
+		}
+		if !n.Deleted() && tree.Value(n) != vals[i] {
+			t.Errorf("node of %d now holds %d", vals[i], tree.Value(n))
+		}
+		if n.Deleted() && (n.Next() != nil || n.Prev() != nil) {
+			t.Errorf("deleted node of %d has neighbors", vals[i])
+		}
+	}
+	if err := tree.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+type Person struct {
+	last, first string
+	id          int
+}
+
+var byName = avl.Chain(
+	func(a, b Person) int { return strings.Compare(a.last, b.last) },
+	func(a, b Person) int { return strings.Compare(a.first, b.first) },
+	func(a, b Person) int { return a.id - b.id },
+)
+
+type People struct {
+	*avl.Tree
+	Insert func(Person)
+	Value  func(*avl.Node) Person
+}
+
+func (People) Compare(a, b Person) int {
+	return byName(a, b)
+}
+
+func (p *People) SetTree(t *avl.Tree) {
+	p.Tree = t
+}
+
+func TestChain(t *testing.T) {
+	want := []Person{
+		{"Doe", "Jane", 1},
+		{"Doe", "Jane", 2},
+		{"Doe", "John", 0},
+		{"Roe", "Adam", 5},
+		{"Roe", "Zoe", 3},
+	}
+	var p People
+	if err := avl.Make(&p); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range rng.Perm(len(want)) {
+		p.Insert(want[i])
+	}
+	i := 0
+	p.Walk(func(n *avl.Node) bool {
+		if got := p.Value(n); got != want[i] {
+			t.Errorf("element %d is %v, want %v", i, got, want[i])
+		}
+		i++
+		return true
+	})
+	if i != len(want) {
+		t.Errorf("tree has %d elements, want %d", i, len(want))
+	}
+}
+
+func TestDeleteRankRange(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		tree := newRandIntTree(rng.Intn(300), randMax, t)
+		var vals []int
+		tree.Walk(func(n *avl.Node) bool {
+			vals = append(vals, tree.Value(n))
+			return true
+		})
+		a, b := rng.Intn(len(vals)+10)-5, rng.Intn(len(vals)+10)-5
+		ca, cb := a, b
+		if ca < 0 {
+			ca = 0
+		}
+		if cb > len(vals) {
+			cb = len(vals)
+		}
+		if ca > len(vals) {
+			ca = len(vals)
+		}
+		if cb < ca {
+			cb = ca
+		}
+		if n := tree.DeleteRankRange(a, b); n != cb-ca {
+			t.Fatalf("DeleteRankRange(%d, %d) of %d elements = %d, want %d", a, b, len(vals), n, cb-ca)
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("DeleteRankRange(%d, %d) of %d elements: %v", a, b, len(vals), err)
+		}
+		want := append(vals[:ca:ca], vals[cb:]...)
+		var got []int
+		tree.Walk(func(n *avl.Node) bool {
+			got = append(got, tree.Value(n))
+			return true
+		})
+		if !equalInts(got, want) {
+			t.Fatalf("DeleteRankRange(%d, %d) left %v, want %v", a, b, got, want)
+		}
+	}
+}
+
+func TestSymmetricDiff(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		a := newRandIntTree(rng.Intn(100), 200, t)
+		b := newRandIntTree(rng.Intn(100), 200, t)
+		inA, inB := make(map[int]bool), make(map[int]bool)
+		a.Walk(func(n *avl.Node) bool { inA[a.Value(n)] = true; return true })
+		b.Walk(func(n *avl.Node) bool { inB[b.Value(n)] = true; return true })
+		var wantA, wantB []int
+		for v := 0; v < 200; v++ {
+			switch {
+			case inA[v] && !inB[v]:
+				wantA = append(wantA, v)
+			case inB[v] && !inA[v]:
+				wantB = append(wantB, v)
+			}
+		}
+		sizeA, sizeB := a.Size(), b.Size()
+		onlyA, onlyB := a.SymmetricDiff(a.Tree, b.Tree)
+		if !equalInts(onlyA, wantA) || !equalInts(onlyB, wantB) {
+			t.Fatalf("SymmetricDiff = %v, %v, want %v, %v", onlyA, onlyB, wantA, wantB)
+		}
+		if a.Size() != sizeA || b.Size() != sizeB {
+			t.Fatalf("SymmetricDiff modified its arguments")
+		}
+	}
+}
+
+type CountingTree struct {
+	ForEachFrom func(int, func(int) bool)
+	Insert      func(int)
+	ncmp        int
+}
+
+func (tree *CountingTree) Compare(a, b int) int {
+	tree.ncmp++
+	return a - b
+}
+
+func TestForEachFrom(t *testing.T) {
+	var tree CountingTree
+	if err := avl.Make(&tree); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2000; i += 2 {
+		tree.Insert(i)
+	}
+	tree.ncmp = 0
+	var got []int
+	tree.ForEachFrom(1001, func(v int) bool {
+		got = append(got, v)
+		return len(got) < 3
+	})
+	if want := []int{1002, 1004, 1006}; !equalInts(got, want) {
+		t.Errorf("ForEachFrom(1001) visited %v, want %v", got, want)
+	}
+	if tree.ncmp > 15 {
+		t.Errorf("ForEachFrom(1001) made %d comparisons in a tree of 1000 elements", tree.ncmp)
+	}
+
+	got = nil
+	tree.ForEachFrom(1998, func(v int) bool {
+		got = append(got, v)
+		return true
+	})
+	if want := []int{1998}; !equalInts(got, want) {
+		t.Errorf("ForEachFrom(1998) visited %v, want %v", got, want)
+	}
+	tree.ForEachFrom(1999, func(v int) bool {
+		t.Errorf("ForEachFrom(1999) visited %d", v)
+		return true
+	})
+}
+
+func TestSaveLoad(t *testing.T) {
+	tree := newRandIntTree(1000, randMax, t)
+	var buf bytes.Buffer
+	if err := tree.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	saved := buf.Bytes()
+
+	var loaded FullIntTree
+	avl.Make(&loaded)
+	loaded.Insert(-1)
+	if err := loaded.Load(bytes.NewReader(saved)); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Size() != tree.Size() {
+		t.Fatalf("loaded %d elements, want %d", loaded.Size(), tree.Size())
+	}
+	for a, b := tree.Min(), loaded.Min(); a != nil; a, b = a.Next(), b.Next() {
+		if tree.Value(a) != loaded.Value(b) {
+			t.Fatalf("loaded %d, want %d", loaded.Value(b), tree.Value(a))
+		}
+	}
+
+	future := append([]byte(nil), saved...)
+	future[4]++
+	err := loaded.Load(bytes.NewReader(future))
+	if err == nil || !strings.Contains(err.Error(), "unsupported encoding version 2") {
+		t.Errorf("Load of a version 2 encoding returned %v", err)
+	}
+
+	var floats FloatTree
+	avl.Make(&floats)
+	err = floats.Load(bytes.NewReader(saved))
+	if err == nil || !strings.Contains(err.Error(), "elements are of type int, want float64") {
+		t.Errorf("Load of ints into a float64 tree returned %v", err)
+	}
+
+	var nan FloatTree
+	avl.Make(&nan, avl.Multiset())
+	nan.Insert(math.NaN())
+	nan.Insert(math.NaN())
+	buf.Reset()
+	if err := nan.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var noNaN FloatTree
+	avl.Make(&noNaN, avl.Multiset(), avl.RejectNaN())
+	err = noNaN.Load(&buf)
+	if err == nil || !strings.Contains(err.Error(), "element 0: NaN element") {
+		t.Errorf("Load of NaN with RejectNaN returned %v", err)
+	}
+
+	err = loaded.Load(strings.NewReader("not a tree"))
+	if err == nil || !strings.Contains(err.Error(), "not an encoded tree") {
+		t.Errorf("Load of garbage returned %v", err)
+	}
+	if loaded.Size() != tree.Size() {
+		t.Errorf("failed Load changed the tree")
+	}
+}
+
+func TestCountWhileOrdered(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if n := tree.CountWhileOrdered(func(int) bool { return true }); n != 0 {
+		t.Errorf("CountWhileOrdered of an empty tree = %d", n)
+	}
+	for i := 0; i < 100; i++ {
+		tree.Insert(i * 10)
+	}
+	for _, cut := range []int{-5, 0, 5, 10, 495, 990, 995} {
+		want := 0
+		for i := 0; i < 100; i++ {
+			if i*10 < cut {
+				want++
+			}
+		}
+		if n := tree.CountWhileOrdered(func(v int) bool { return v < cut }); n != want {
+			t.Errorf("CountWhileOrdered(v < %d) = %d, want %d", cut, n, want)
+		}
+		if n := tree.CountWhileOrdered(func(v int) bool { return v >= cut }); n != 100-want {
+			t.Errorf("CountWhileOrdered(v >= %d) = %d, want %d", cut, n, 100-want)
+		}
+	}
+}
+
+func TestMustMake(t *testing.T) {
+	var tree FullIntTree
+	avl.MustMake(&tree)
+	tree.Insert(1)
+	if _, ok := tree.Lookup(1); !ok {
+		t.Errorf("Lookup(1) after MustMake failed")
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("MustMake of a struct without Compare did not panic")
+		}
+	}()
+	var bad struct{ Insert func(int) }
+	avl.MustMake(&bad)
+}
+
+func TestAux(t *testing.T) {
+	tree := newRandIntTree(500, randMax, t)
+	tree.Walk(func(n *avl.Node) bool {
+		n.SetAux(fmt.Sprint(tree.Value(n)))
+		return true
+	})
+	for i := 0; i < 500; i++ {
+		tree.Insert(rng.Intn(randMax) + randMax)
+		tree.Delete(rng.Intn(randMax))
+	}
+	tree.Walk(func(n *avl.Node) bool {
+		v := tree.Value(n)
+		if v < randMax && n.Aux() != fmt.Sprint(v) {
+			t.Fatalf("Node holding %d has Aux %v", v, n.Aux())
+		}
+		if v >= randMax && n.Aux() != nil {
+			t.Fatalf("new Node holding %d has Aux %v", v, n.Aux())
+		}
+		return true
+	})
+}
+
+func TestLowerUpperBound(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 20; i += 2 {
+		tree.Insert(i)
+	}
+	value := func(n *avl.Node) int {
+		if n == nil {
+			return -1
+		}
+		return tree.Value(n)
+	}
+	tests := []struct {
+		k, lb, ub int
+	}{
+		{-3, 0, 0},
+		{0, 0, 2},
+		{7, 8, 8},
+		{8, 8, 10},
+		{18, 18, -1},
+		{19, -1, -1},
+	}
+	for _, test := range tests {
+		if lb := value(tree.LowerBound(test.k)); lb != test.lb {
+			t.Errorf("LowerBound(%d) = %d, want %d", test.k, lb, test.lb)
+		}
+		if ub := value(tree.UpperBound(test.k)); ub != test.ub {
+			t.Errorf("UpperBound(%d) = %d, want %d", test.k, ub, test.ub)
+		}
+	}
+}
+
+func TestInsertSeq(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	want := make(map[int]bool)
+	for i := 0; i < 200; i++ {
+		v := rng.Intn(randMax)
+		tree.Insert(v)
+		want[v] = true
+	}
+
+	// An ascending run past the maximum, then out of order
+	// elements, then another run.
+	var vals []int
+	for i := 0; i < 1000; i++ {
+		vals = append(vals, randMax+i*2)
+	}
+	for i := 0; i < 100; i++ {
+		vals = append(vals, rng.Intn(3*randMax))
+	}
+	for i := 0; i < 1000; i++ {
+		vals = append(vals, 4*randMax+i)
+	}
+	for _, v := range vals {
+		want[v] = true
+	}
+	tree.InsertSeq(slices.Values(vals))
+
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Size() != len(want) {
+		t.Fatalf("tree has %d elements, want %d", tree.Size(), len(want))
+	}
+	for v := range want {
+		if _, ok := tree.Lookup(v); !ok {
+			t.Fatalf("Lookup(%d) failed after InsertSeq", v)
+		}
+	}
+}
+
+func TestGetOr(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	tree.Insert(3)
+	if v := tree.GetOr(3, -1); v != 3 {
+		t.Errorf("GetOr(3, -1) = %d, want 3", v)
+	}
+	if v := tree.GetOr(4, -1); v != -1 {
+		t.Errorf("GetOr(4, -1) = %d, want -1", v)
+	}
+}
+
+func TestParallelBuild(t *testing.T) {
+	for _, workers := range []int{0, 1, 3, 8} {
+		for _, size := range []int{0, 1, 2, 7, 1000} {
+			var tree FullIntTree
+			avl.Make(&tree)
+			tree.Insert(-1)
+			vals := make([]int, size)
+			for i := range vals {
+				vals[i] = i
+			}
+			if err := tree.ParallelBuild(vals, workers); err != nil {
+				t.Fatal(err)
+			}
+			if err := tree.Validate(); err != nil {
+				t.Fatalf("ParallelBuild of %d elements with %d workers: %v", size, workers, err)
+			}
+			i := -1
+			tree.Walk(func(n *avl.Node) bool {
+				if v := tree.Value(n); v != i {
+					t.Fatalf("ParallelBuild of %d elements with %d workers: found %d, want %d", size, workers, v, i)
+				}
+				i++
+				return true
+			})
+			if i != size {
+				t.Fatalf("ParallelBuild of %d elements with %d workers: walked %d", size, workers, i+1)
+			}
+		}
+	}
+
+	var tree FullIntTree
+	avl.Make(&tree)
+	if err := tree.ParallelBuild([]int{1, 3, 2}, 2); err == nil {
+		t.Errorf("ParallelBuild of unsorted elements succeeded")
+	}
+	if tree.Size() != 0 {
+		t.Errorf("failed ParallelBuild changed the tree")
+	}
+}
+
+type Record struct {
+	key  int
+	tags []string
+}
+
+type RecordTree struct {
+	Insert func(Record)
+	Lookup func(Record) (Record, bool)
+}
+
+func (RecordTree) Compare(a, b Record) int {
+	return a.key - b.key
+}
+
+type CopyingRecordTree struct {
+	RecordTree
+}
+
+func (CopyingRecordTree) Copy(r Record) Record {
+	r.tags = append([]string(nil), r.tags...)
+	return r
+}
+
+func TestCopy(t *testing.T) {
+	var aliased RecordTree
+	var copied CopyingRecordTree
+	if err := avl.Make(&aliased); err != nil {
+		t.Fatal(err)
+	}
+	if err := avl.Make(&copied); err != nil {
+		t.Fatal(err)
+	}
+
+	r := Record{1, []string{"a"}}
+	aliased.Insert(r)
+	copied.Insert(r)
+	r.key = 2
+	r.tags[0] = "b"
+
+	if got, _ := aliased.Lookup(Record{key: 1}); got.tags[0] != "b" {
+		t.Errorf("without Copy the stored slice is %v, want it shared with the caller", got.tags)
+	}
+	if got, _ := copied.Lookup(Record{key: 1}); got.tags[0] != "a" {
+		t.Errorf("with Copy the stored slice is %v, want [a]", got.tags)
+	}
+
+	var bad BadCopyTree
+	if err := avl.Make(&bad); err == nil {
+		t.Errorf("Make accepted a Copy method with the wrong signature")
+	}
+}
+
+type BadCopyTree struct {
+	RecordTree
+}
+
+func (BadCopyTree) Copy(r *Record) {}
+
+func TestRemoveMinMax(t *testing.T) {
+	tree := newRandIntTree(300, randMax, t)
+	for tree.Size() > 0 {
+		min, max := tree.Value(tree.Min()), tree.Value(tree.Max())
+		size := tree.Size()
+		remove, removed := tree.RemoveMin, min
+		if rng.Intn(2) == 0 {
+			remove, removed = tree.RemoveMax, max
+		}
+		if !remove() {
+			t.Fatalf("remove from a tree of %d elements failed", size)
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := tree.Lookup(removed); ok || tree.Size() != size-1 {
+			t.Fatalf("%d was not removed", removed)
+		}
+	}
+	if tree.RemoveMin() || tree.RemoveMax() {
+		t.Errorf("remove from an empty tree succeeded")
+	}
+}
+
+func TestZip(t *testing.T) {
+	var a, b FullIntTree
+	avl.Make(&a)
+	avl.Make(&b)
+	for _, v := range []int{1, 4, 5, 9} {
+		a.Insert(v)
+	}
+	for _, v := range []int{2, 4, 6} {
+		b.Insert(v)
+	}
+	var got []string
+	a.Zip(a.Tree, b.Tree, func(v int, fromA bool) bool {
+		src := "b"
+		if fromA {
+			src = "a"
+		}
+		got = append(got, fmt.Sprint(v, src))
+		return true
+	})
+	want := []string{"1a", "2b", "4a", "4b", "5a", "6b", "9a"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Zip visited %q, want %q", got, want)
+	}
+
+	got = got[:0]
+	a.Zip(b.Tree, a.Tree, func(v int, fromA bool) bool {
+		got = append(got, fmt.Sprint(v))
+		return v < 4
+	})
+	if want := []string{"1", "2", "4"}; !slices.Equal(got, want) {
+		t.Errorf("Zip stopped early visited %q, want %q", got, want)
+	}
+}
+
+func TestSampleK(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 10; i++ {
+		tree.Insert(i)
+	}
+	r := rand.New(rand.NewSource(1))
+	if s := tree.SampleK(0, r); len(s) != 0 {
+		t.Errorf("SampleK(0) = %v", s)
+	}
+	s := tree.SampleK(20, r)
+	slices.Sort(s)
+	if want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !slices.Equal(s, want) {
+		t.Errorf("SampleK(20) sorted = %v, want %v", s, want)
+	}
+
+	const trials = 10000
+	var counts [10]int
+	for i := 0; i < trials; i++ {
+		s := tree.SampleK(3, r)
+		seen := make(map[int]bool)
+		for _, v := range s {
+			if seen[v] {
+				t.Fatalf("SampleK(3) = %v repeats %d", s, v)
+			}
+			seen[v] = true
+			counts[v]++
+		}
+		if len(s) != 3 {
+			t.Fatalf("SampleK(3) = %v", s)
+		}
+	}
+	for v, n := range counts {
+		if want := trials * 3 / 10; n < want*9/10 || n > want*11/10 {
+			t.Errorf("%d was sampled %d times, want about %d", v, n, want)
+		}
+	}
+}
+
+func TestWalkPairs(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	tree.WalkPairs(func(int, int, bool) bool {
+		t.Fatal("WalkPairs of an empty tree called visit")
+		return false
+	})
+	for _, v := range []int{10, 13, 14, 20, 21} {
+		tree.Insert(v)
+	}
+	var gaps []int
+	tree.WalkPairs(func(prev, cur int, hasPrev bool) bool {
+		if !hasPrev {
+			if prev != 0 || cur != 10 {
+				t.Errorf("first call of visit got %d, %d", prev, cur)
+			}
+			return true
+		}
+		gaps = append(gaps, cur-prev)
+		return cur < 20
+	})
+	if want := []int{3, 1, 6}; !slices.Equal(gaps, want) {
+		t.Errorf("WalkPairs gave gaps %v, want %v", gaps, want)
+	}
+}
+
+func TestFirstDifference(t *testing.T) {
+	var a, b FullIntTree
+	avl.Make(&a)
+	avl.Make(&b)
+	check := func(wantIndex, wantA, wantB int, wantOK bool) {
+		t.Helper()
+		i, va, vb, ok := a.FirstDifference(a.Tree, b.Tree)
+		if i != wantIndex || va != wantA || vb != wantB || ok != wantOK {
+			t.Errorf("FirstDifference = %d, %d, %d, %v, want %d, %d, %d, %v", i, va, vb, ok, wantIndex, wantA, wantB, wantOK)
+		}
+	}
+	check(-1, 0, 0, false)
+	for i := 1; i <= 5; i++ {
+		a.Insert(i)
+		b.Insert(i)
+	}
+	check(-1, 0, 0, false)
+	b.Insert(6)
+	check(5, 0, 6, true)
+	a.Insert(7)
+	check(5, 7, 6, true)
+	a.Delete(1)
+	check(0, 2, 1, true)
+}
+
+func TestClamp(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if _, ok := tree.Clamp(5); ok {
+		t.Errorf("Clamp in an empty tree succeeded")
+	}
+	for i := 10; i <= 50; i += 10 {
+		tree.Insert(i)
+	}
+	for _, test := range [][2]int{{-5, 10}, {10, 10}, {19, 10}, {20, 20}, {45, 40}, {50, 50}, {99, 50}} {
+		if v, ok := tree.Clamp(test[0]); v != test[1] || !ok {
+			t.Errorf("Clamp(%d) = %d, %v, want %d, true", test[0], v, ok, test[1])
+		}
+	}
+}
+
+func TestSibling(t *testing.T) {
+	tree := newRandIntTree(200, randMax, t)
+	if s := tree.Root().Sibling(); s != nil {
+		t.Errorf("root has sibling %d", tree.Value(s))
+	}
+	var nilNode *avl.Node
+	if s := nilNode.Sibling(); s != nil {
+		t.Errorf("nil Node has a sibling")
+	}
+	tree.Walk(func(n *avl.Node) bool {
+		s := n.Sibling()
+		if s == nil {
+			return true
+		}
+		if s == n || s.Sibling() != n {
+			t.Fatalf("Sibling of %d is %d, whose Sibling is not %d", tree.Value(n), tree.Value(s), tree.Value(n))
+		}
+		return true
+	})
+}
+
+func TestHasRange(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if tree.HasRange(0, 100) {
+		t.Errorf("HasRange(0, 100) in an empty tree is true")
+	}
+	for i := 10; i <= 50; i += 10 {
+		tree.Insert(i)
+	}
+	tests := []struct {
+		lo, hi int
+		want   bool
+	}{
+		{0, 9, false},
+		{0, 10, true},
+		{11, 19, false},
+		{15, 25, true},
+		{50, 50, true},
+		{51, 100, false},
+		{30, 10, false},
+	}
+	for _, test := range tests {
+		if got := tree.HasRange(test.lo, test.hi); got != test.want {
+			t.Errorf("HasRange(%d, %d) = %v, want %v", test.lo, test.hi, got, test.want)
+		}
+	}
+}
+
+func TestMultisetInsertionOrder(t *testing.T) {
+	var m PairMultiset
+	if err := avl.Make(&m, avl.Multiset()); err != nil {
+		t.Fatal(err)
+	}
+	const nKeys = 5
+	for i := 0; i < 5000; i++ {
+		if rng.Intn(3) == 0 {
+			m.Delete(pair{key: rng.Intn(nKeys)})
+		} else {
+			m.Insert(pair{rng.Intn(nKeys), i})
+		}
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for k := 0; k < nKeys; k++ {
+		ps := m.EqualRange(pair{key: k})
+		for i := 1; i < len(ps); i++ {
+			if ps[i].val <= ps[i-1].val {
+				t.Fatalf("EqualRange(%d) not in insertion order after deletions: %d after %d", k, ps[i].val, ps[i-1].val)
+			}
+		}
+	}
+}
+
+type BrokenIntTree struct {
+	Insert func(int)
+}
+
+func (BrokenIntTree) Compare(a, b int) int {
+	if a < b {
+		return -1
+	}
+	return 1
+}
+
+type ReverseStringTree struct {
+	Insert func(string)
+}
+
+func (ReverseStringTree) Compare(a, b string) int {
+	return strings.Compare(b, a)
+}
+
+func TestMakeChecked(t *testing.T) {
+	var ints FullIntTree
+	if err := avl.MakeChecked(&ints); err != nil {
+		t.Errorf("MakeChecked(FullIntTree): %v", err)
+	}
+	var floats FloatTree
+	if err := avl.MakeChecked(&floats, avl.RejectNaN()); err != nil {
+		t.Errorf("MakeChecked(FloatTree): %v", err)
+	}
+	var broken BrokenIntTree
+	if err := avl.MakeChecked(&broken); err == nil {
+		t.Errorf("MakeChecked accepted a Compare that never returns 0")
+	}
+	var reverse ReverseStringTree
+	if err := avl.MakeChecked(&reverse); err == nil {
+		t.Errorf("MakeChecked accepted a reversed Compare")
+	}
+	if err := avl.Make(&reverse); err != nil {
+		t.Errorf("Make rejected a reversed Compare: %v", err)
+	}
+	var people People
+	if err := avl.MakeChecked(&people); err != nil {
+		t.Errorf("MakeChecked(People): %v", err)
+	}
+}
+
+type CountedTree struct {
+	FullIntTree
+	hits, misses int
+}
+
+func (tree *CountedTree) OnLookup(key int, found bool) {
+	if found {
+		tree.hits++
+	} else {
+		tree.misses++
+	}
+}
+
+func TestOnLookup(t *testing.T) {
+	var tree CountedTree
+	if err := avl.Make(&tree); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		tree.Insert(i)
+	}
+	for i := 0; i < 15; i++ {
+		if v, ok := tree.Lookup(i); ok != (i < 10) || ok && v != i {
+			t.Errorf("Lookup(%d) = %d, %v", i, v, ok)
+		}
+	}
+	tree.GetOr(20, 0)
+	if tree.hits != 10 || tree.misses != 6 {
+		t.Errorf("OnLookup counted %d hits and %d misses, want 10 and 6", tree.hits, tree.misses)
+	}
+}
+
+func TestLookupMany(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 10; i += 2 {
+		tree.Insert(i)
+	}
+	keys := []int{8, 3, 0, 4, 11, 4}
+	vals, found := tree.LookupMany(keys)
+	wantVals := []int{8, 0, 0, 4, 0, 4}
+	wantFound := []bool{true, false, true, true, false, true}
+	if !equalInts(vals, wantVals) {
+		t.Errorf("LookupMany(%v) values = %v, want %v", keys, vals, wantVals)
+	}
+	for i := range wantFound {
+		if found[i] != wantFound[i] {
+			t.Errorf("LookupMany(%v) found = %v, want %v", keys, found, wantFound)
+			break
+		}
+	}
+}
+
+// PanickyTree has a Compare that panics when
+// either argument is 13.
+type PanickyTree struct {
+	*avl.Tree
+	Insert    func(int)
+	Delete    func(int)
+	InsertSeq func(seq func(yield func(int) bool))
+}
+
+func (PanickyTree) Compare(a, b int) int {
+	if a == 13 || b == 13 {
+		panic("unlucky")
+	}
+	return a - b
+}
+
+func (tree *PanickyTree) SetTree(t *avl.Tree) {
+	tree.Tree = t
+}
+
+func TestComparePanic(t *testing.T) {
+	var tree PanickyTree
+	avl.Make(&tree)
+	try := func(op func(int), v int) (panicked bool) {
+		defer func() {
+			panicked = recover() != nil
+		}()
+		op(v)
+		return false
+	}
+	// Compare is not called to insert into an empty tree,
+	// so keep 0 in the tree to make sure 13 never gets in.
+	tree.Insert(0)
+	for i := 0; i < 2000; i++ {
+		v := 1 + rng.Intn(50)
+		op := tree.Insert
+		if rng.Intn(3) == 0 {
+			op = tree.Delete
+		}
+		size := tree.Size()
+		if try(op, v) {
+			if v != 13 {
+				t.Fatalf("Compare panicked on %d", v)
+			}
+			if tree.Size() != size {
+				t.Fatalf("size changed from %d to %d by an operation that panicked", size, tree.Size())
+			}
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("after a panic in Compare: %v", err)
+		}
+	}
+}
+
+func TestInsertSeqPanic(t *testing.T) {
+	var tree PanickyTree
+	avl.Make(&tree)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("InsertSeq did not pass on the panic in Compare")
+			}
+		}()
+		tree.InsertSeq(func(yield func(int) bool) {
+			for i := 10; i < 20; i++ {
+				if !yield(i) {
+					return
+				}
+			}
+		})
+	}()
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Size() != 3 {
+		t.Errorf("InsertSeq kept %d elements inserted before the panic, want 3", tree.Size())
+	}
+}
+
+func TestReplaceAll(t *testing.T) {
+	tree := newRandIntTree(100, randMax, t)
+	old := tree.Min()
+	vals := []int{5, 3, 9, 3, 1, 5, 7}
+	if dups := tree.ReplaceAll(vals); dups != 2 {
+		t.Errorf("ReplaceAll(%v) = %d, want 2", vals, dups)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	tree.Walk(func(n *avl.Node) bool {
+		got = append(got, tree.Value(n))
+		return true
+	})
+	if want := []int{1, 3, 5, 7, 9}; !equalInts(got, want) {
+		t.Errorf("after ReplaceAll(%v) the tree holds %v, want %v", vals, got, want)
+	}
+	if !old.Deleted() {
+		t.Errorf("a Node replaced by ReplaceAll is not marked deleted")
+	}
+	if vals[0] != 5 {
+		t.Errorf("ReplaceAll sorted its argument")
+	}
+
+	var m PairMultiset
+	avl.Make(&m, avl.Multiset())
+	if dups := m.ReplaceAll([]pair{{2, 0}, {1, 1}, {2, 2}, {1, 3}}); dups != 0 {
+		t.Errorf("ReplaceAll of a multiset dropped %d elements", dups)
+	}
+	if ps := m.EqualRange(pair{key: 2}); len(ps) != 2 || ps[0].val != 0 || ps[1].val != 2 {
+		t.Errorf("ReplaceAll of a multiset did not keep equal elements in order: %v", ps)
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if _, ok1, _, ok2 := tree.Neighbors(5); ok1 || ok2 {
+		t.Errorf("Neighbors in an empty tree found something")
+	}
+	for i := 10; i <= 50; i += 10 {
+		tree.Insert(i)
+	}
+	tests := []struct {
+		k, floor int
+		floorOk  bool
+		ceil     int
+		ceilOk   bool
+	}{
+		{5, 0, false, 10, true},
+		{10, 10, true, 10, true},
+		{25, 20, true, 30, true},
+		{50, 50, true, 50, true},
+		{55, 50, true, 0, false},
+	}
+	for _, test := range tests {
+		floor, floorOk, ceil, ceilOk := tree.Neighbors(test.k)
+		if floor != test.floor || floorOk != test.floorOk || ceil != test.ceil || ceilOk != test.ceilOk {
+			t.Errorf("Neighbors(%d) = %d, %v, %d, %v, want %d, %v, %d, %v", test.k,
+				floor, floorOk, ceil, ceilOk, test.floor, test.floorOk, test.ceil, test.ceilOk)
+		}
+	}
+}
+
+func TestFloor(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if v, ok := tree.Floor(5); v != 0 || ok {
+		t.Errorf("Floor(5) of an empty tree = %d, %v", v, ok)
+	}
+	for i := 10; i <= 50; i += 10 {
+		tree.Insert(i)
+	}
+	tests := []struct {
+		k, floor int
+		ok       bool
+	}{
+		{5, 0, false},
+		{10, 10, true},
+		{25, 20, true},
+		{50, 50, true},
+		{55, 50, true},
+	}
+	for _, test := range tests {
+		if v, ok := tree.Floor(test.k); v != test.floor || ok != test.ok {
+			t.Errorf("Floor(%d) = %d, %v, want %d, %v", test.k, v, ok, test.floor, test.ok)
+		}
+	}
+}
+
+func TestCeiling(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if v, ok := tree.Ceiling(5); v != 0 || ok {
+		t.Errorf("Ceiling(5) of an empty tree = %d, %v", v, ok)
+	}
+	for i := 10; i <= 50; i += 10 {
+		tree.Insert(i)
+	}
+	tests := []struct {
+		k, ceil int
+		ok      bool
+	}{
+		{5, 10, true},
+		{10, 10, true},
+		{25, 30, true},
+		{50, 50, true},
+		{55, 0, false},
+	}
+	for _, test := range tests {
+		if v, ok := tree.Ceiling(test.k); v != test.ceil || ok != test.ok {
+			t.Errorf("Ceiling(%d) = %d, %v, want %d, %v", test.k, v, ok, test.ceil, test.ok)
+		}
+	}
+}
+
+func TestHigherLower(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if _, ok := tree.Higher(5); ok {
+		t.Error("Higher in an empty tree found something")
+	}
+	if _, ok := tree.Lower(5); ok {
+		t.Error("Lower in an empty tree found something")
+	}
+	for i := 10; i <= 50; i += 10 {
+		tree.Insert(i)
+	}
+	tests := []struct {
+		k             int
+		lower, higher int
+		lowOk, highOk bool
+	}{
+		{5, 0, 10, false, true},
+		{10, 0, 20, false, true},
+		{25, 20, 30, true, true},
+		{30, 20, 40, true, true},
+		{50, 40, 0, true, false},
+		{55, 50, 0, true, false},
+	}
+	for _, test := range tests {
+		if v, ok := tree.Lower(test.k); v != test.lower || ok != test.lowOk {
+			t.Errorf("Lower(%d) = %d, %v, want %d, %v", test.k, v, ok, test.lower, test.lowOk)
+		}
+		if v, ok := tree.Higher(test.k); v != test.higher || ok != test.highOk {
+			t.Errorf("Higher(%d) = %d, %v, want %d, %v", test.k, v, ok, test.higher, test.highOk)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if r := tree.Rank(5); r != 0 {
+		t.Errorf("Rank(5) of an empty tree = %d", r)
+	}
+	var vals []int
+	for i := 0; i < 500; i++ {
+		v := rng.Intn(1000)
+		tree.Insert(v)
+		if !slices.Contains(vals, v) {
+			vals = append(vals, v)
+		}
+		if i%2 == 1 {
+			v := vals[0]
+			tree.Delete(v)
+			vals = vals[1:]
+		}
+	}
+	for k := -1; k <= 1000; k++ {
+		want := 0
+		for _, v := range vals {
+			if v < k {
+				want++
+			}
+		}
+		if r := tree.Rank(k); r != want {
+			t.Fatalf("Rank(%d) = %d, want %d", k, r, want)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if _, ok := tree.Select(0); ok {
+		t.Error("Select(0) of an empty tree found something")
+	}
+	for i := 0; i < 200; i++ {
+		tree.Insert(rng.Intn(1000))
+	}
+	k := 0
+	tree.Walk(func(n *avl.Node) bool {
+		v := tree.Value(n)
+		if got, ok := tree.Select(k); got != v || !ok {
+			t.Errorf("Select(%d) = %d, %v, want %d, true", k, got, ok, v)
+		}
+		if r := tree.Rank(v); r != k {
+			t.Errorf("Rank(Select(%d)) = %d", k, r)
+		}
+		k++
+		return true
+	})
+	for _, k := range []int{-1, tree.Size()} {
+		if v, ok := tree.Select(k); v != 0 || ok {
+			t.Errorf("Select(%d) = %d, %v, want 0, false", k, v, ok)
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 20; i += 2 {
+		tree.Insert(i)
+	}
+	tests := []struct {
+		lo, hi int
+		want   []int
+	}{
+		{3, 9, []int{4, 6, 8}},
+		{4, 8, []int{4, 6}},
+		{-10, 2, []int{0}},
+		{17, 100, []int{18}},
+		{6, 6, nil},
+		{9, 3, nil},
+	}
+	for _, test := range tests {
+		var got []int
+		tree.Range(test.lo, test.hi, func(v int) bool {
+			got = append(got, v)
+			return true
+		})
+		if !slices.Equal(got, test.want) {
+			t.Errorf("Range(%d, %d) visited %v, want %v", test.lo, test.hi, got, test.want)
+		}
+	}
+	var got []int
+	tree.Range(0, 20, func(v int) bool {
+		got = append(got, v)
+		return v < 4
+	})
+	if want := []int{0, 2, 4}; !slices.Equal(got, want) {
+		t.Errorf("Range stopped early visited %v, want %v", got, want)
+	}
+}
+
+func TestCount(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 20; i += 2 {
+		tree.Insert(i)
+	}
+	tests := []struct{ lo, hi, want int }{
+		{3, 9, 3},
+		{4, 8, 3},
+		{-10, 0, 1},
+		{17, 100, 1},
+		{6, 6, 1},
+		{7, 7, 0},
+		{9, 3, 0},
+		{-5, 50, 10},
+	}
+	for _, test := range tests {
+		if n := tree.Count(test.lo, test.hi); n != test.want {
+			t.Errorf("Count(%d, %d) = %d, want %d", test.lo, test.hi, n, test.want)
+		}
+	}
+}
+
+func TestClear(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 100; i++ {
+		tree.Insert(i)
+	}
+	n := tree.Min().Next()
+	tree.Clear()
+	if tree.Size() != 0 || tree.Min() != nil || tree.Max() != nil {
+		t.Fatalf("after Clear Size is %d, Min is %v, Max is %v", tree.Size(), tree.Min(), tree.Max())
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !n.Deleted() {
+		t.Error("a Node cleared from the tree is not marked deleted")
+	}
+	tree.Insert(7)
+	if v, ok := tree.Lookup(7); !ok || v != 7 || tree.Size() != 1 {
+		t.Errorf("after Clear and Insert(7), Lookup(7) = %d, %v and Size is %d", v, ok, tree.Size())
+	}
+}
+
+func TestClone(t *testing.T) {
+	tree := newRandIntTree(300, randMax, t)
+	var want []int
+	tree.Walk(func(n *avl.Node) bool {
+		want = append(want, tree.Value(n))
+		return true
+	})
+	c := tree.Clone()
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Size() != tree.Size() || c.Height() != tree.Height() {
+		t.Fatalf("clone has size %d and height %d, want %d and %d", c.Size(), c.Height(), tree.Size(), tree.Height())
+	}
+	for i := 0; i < randMax; i += 2 {
+		tree.Delete(i)
+	}
+	var got []int
+	c.Walk(func(n *avl.Node) bool {
+		if n.Deleted() {
+			t.Fatalf("Node %d of the clone was deleted from the original", tree.Value(n))
+		}
+		got = append(got, tree.Value(n))
+		return true
+	})
+	if !slices.Equal(got, want) {
+		t.Errorf("clone holds %v after deleting from the original, want %v", got, want)
+	}
+
+	// Roll the tree back to the snapshot.
+	tree.Restore(c)
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Size() != 0 || c.Min() != nil {
+		t.Errorf("Restore left %d elements in the clone", c.Size())
+	}
+	for _, v := range want {
+		if _, ok := tree.Lookup(v); !ok {
+			t.Fatalf("Lookup(%d) after Restore found nothing", v)
+		}
+	}
+	if got := tree.Keys(); !slices.Equal(got, want) {
+		t.Errorf("after Restore the tree holds %v, want %v", got, want)
+	}
+}
+
+func TestDeleteMinMax(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if v, ok := tree.DeleteMin(); v != 0 || ok {
+		t.Errorf("DeleteMin of an empty tree = %d, %v", v, ok)
+	}
+	if v, ok := tree.DeleteMax(); v != 0 || ok {
+		t.Errorf("DeleteMax of an empty tree = %d, %v", v, ok)
+	}
+	for _, i := range rng.Perm(100) {
+		tree.Insert(i)
+	}
+	for lo, hi := 0, 99; lo < hi; lo, hi = lo+1, hi-1 {
+		if v, ok := tree.DeleteMin(); v != lo || !ok {
+			t.Fatalf("DeleteMin = %d, %v, want %d, true", v, ok, lo)
+		}
+		if v, ok := tree.DeleteMax(); v != hi || !ok {
+			t.Fatalf("DeleteMax = %d, %v, want %d, true", v, ok, hi)
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tree.Size() != 0 {
+		t.Errorf("Size is %d after deleting every element", tree.Size())
+	}
+}
+
+// ReportingTree declares Delete to report
+// whether it deleted anything.
+type ReportingTree struct {
+	Insert func(int)
+	Delete func(int) bool
+}
+
+func (ReportingTree) Compare(a, b int) int {
+	return IntTree{}.Compare(a, b)
+}
+
+func TestDeleteReporting(t *testing.T) {
+	var tree ReportingTree
+	if err := avl.Make(&tree); err != nil {
+		t.Fatal(err)
+	}
+	tree.Insert(1)
+	if !tree.Delete(1) {
+		t.Error("Delete(1) = false after Insert(1)")
+	}
+	if tree.Delete(1) {
+		t.Error("Delete(1) = true after 1 was deleted")
+	}
+}
+
+func TestInsertIfAbsent(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 10; i++ {
+		if v, ok := tree.InsertIfAbsent(i); v != i || !ok {
+			t.Errorf("InsertIfAbsent(%d) = %d, %v, want %d, true", i, v, ok, i)
+		}
+	}
+	if v, ok := tree.InsertIfAbsent(4); v != 4 || ok || tree.Size() != 10 {
+		t.Errorf("InsertIfAbsent(4) of a present element = %d, %v, and Size is %d", v, ok, tree.Size())
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var m PairMultiset
+	avl.Make(&m, avl.Multiset())
+	m.Insert(pair{1, 1})
+	if p, ok := m.InsertIfAbsent(pair{1, 2}); p != (pair{1, 1}) || ok {
+		t.Errorf("InsertIfAbsent into a multiset = %v, %v, want {1 1}, false", p, ok)
+	}
+	if n := len(m.EqualRange(pair{key: 1})); n != 1 {
+		t.Errorf("multiset holds %d elements equal to the one passed to InsertIfAbsent", n)
+	}
+}
+
+func TestGetOrInsert(t *testing.T) {
+	var m PairMultiset
+	avl.Make(&m, avl.Multiset())
+	if p, ok := m.GetOrInsert(pair{1, 10}); p != (pair{1, 10}) || !ok {
+		t.Errorf("GetOrInsert of a missing key = %v, %v, want {1 10}, true", p, ok)
+	}
+	if p, ok := m.GetOrInsert(pair{1, 20}); p != (pair{1, 10}) || ok {
+		t.Errorf("GetOrInsert of a present key = %v, %v, want {1 10}, false", p, ok)
+	}
+	if n := m.Size(); n != 1 {
+		t.Errorf("Size is %d after inserting one key", n)
+	}
+}
+
+func TestContains(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if tree.Contains(0) {
+		t.Error("empty tree contains 0")
+	}
+	for i := 0; i < 100; i += 2 {
+		tree.Insert(i)
+	}
+	for i := -1; i <= 100; i++ {
+		if got, want := tree.Contains(i), i >= 0 && i < 100 && i%2 == 0; got != want {
+			t.Errorf("Contains(%d) = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestNodeLinks(t *testing.T) {
+	tree := newRandIntTree(200, randMax, t)
+	var nilNode *avl.Node
+	if nilNode.Left() != nil || nilNode.Right() != nil || nilNode.Parent() != nil {
+		t.Error("links of a nil Node are not nil")
+	}
+	if tree.Root().Parent() != nil {
+		t.Error("root has a parent")
+	}
+	count := 0
+	var visit func(n *avl.Node)
+	visit = func(n *avl.Node) {
+		if n == nil {
+			return
+		}
+		count++
+		for _, c := range []*avl.Node{n.Left(), n.Right()} {
+			if c != nil && c.Parent() != n {
+				t.Fatalf("child %d of %d has parent %v", tree.Value(c), tree.Value(n), c.Parent())
+			}
+		}
+		if l := n.Left(); l != nil && tree.Value(l) >= tree.Value(n) {
+			t.Fatalf("left child %d of %d is out of order", tree.Value(l), tree.Value(n))
+		}
+		visit(n.Left())
+		visit(n.Right())
+	}
+	visit(tree.Root())
+	if count != tree.Size() {
+		t.Errorf("walking the links visited %d nodes, want %d", count, tree.Size())
+	}
+}
+
+func TestNodeHeight(t *testing.T) {
+	var nilNode *avl.Node
+	if h := nilNode.Height(); h != 0 {
+		t.Errorf("Height of a nil Node is %d", h)
+	}
+	tree := newRandIntTree(300, randMax, t)
+	var check func(n *avl.Node) int
+	check = func(n *avl.Node) int {
+		if n == nil {
+			return 0
+		}
+		want := max(check(n.Left()), check(n.Right())) + 1
+		if h := n.Height(); h != want {
+			t.Fatalf("Height of %d is %d, want %d", tree.Value(n), h, want)
+		}
+		return want
+	}
+	if h := check(tree.Root()); h != tree.Height() {
+		t.Errorf("Height of the root is %d but the tree has height %d", h, tree.Height())
+	}
+}
+
+func TestForEach(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	tree.ForEach(func(int) bool {
+		t.Fatal("ForEach of an empty tree called visit")
+		return false
+	})
+	for _, i := range rng.Perm(10) {
+		tree.Insert(i)
+	}
+	var got []int
+	tree.ForEach(func(v int) bool {
+		got = append(got, v)
+		return v < 5
+	})
+	if want := []int{0, 1, 2, 3, 4, 5}; !slices.Equal(got, want) {
+		t.Errorf("ForEach visited %v, want %v", got, want)
+	}
+}
+
+func TestForEachReverse(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	tree.ForEachReverse(func(int) bool {
+		t.Fatal("ForEachReverse of an empty tree called visit")
+		return false
+	})
+	for _, i := range rng.Perm(10) {
+		tree.Insert(i)
+	}
+	var got []int
+	tree.ForEachReverse(func(v int) bool {
+		got = append(got, v)
+		return v > 5
+	})
+	if want := []int{9, 8, 7, 6, 5}; !slices.Equal(got, want) {
+		t.Errorf("ForEachReverse visited %v, want %v", got, want)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	if got := tree.Keys(); got == nil || len(got) != 0 {
+		t.Errorf("Keys of an empty tree = %#v, want an empty slice", got)
+	}
+	for _, i := range rng.Perm(100) {
+		tree.Insert(i)
+	}
+	got := tree.Keys()
+	if len(got) != 100 || cap(got) != 100 {
+		t.Errorf("Keys returned len %d cap %d, want 100", len(got), cap(got))
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("Keys()[%d] = %d", i, v)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 10; i++ {
+		tree.Insert(-i)
+	}
+	vals := make([]int, 1000)
+	for i := range vals {
+		vals[i] = 2 * i
+	}
+	if err := tree.Build(vals); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.Keys(); !slices.Equal(got, vals) {
+		t.Errorf("after Build the tree holds %v", got)
+	}
+	if h := tree.Height(); h != 10 {
+		t.Errorf("Build of 1000 elements has height %d, want 10", h)
+	}
+
+	if err := tree.Build([]int{1, 3, 2}); err == nil {
+		t.Error("Build of unsorted elements returned no error")
+	}
+	if err := tree.Build([]int{1, 1}); err == nil {
+		t.Error("Build of equal elements returned no error")
+	}
+	if tree.Size() != 1000 {
+		t.Errorf("a failed Build changed the tree")
+	}
+	if err := tree.Build(nil); err != nil || tree.Size() != 0 || tree.Min() != nil {
+		t.Errorf("Build(nil) = %v and left %d elements", err, tree.Size())
+	}
+}
+
+func TestRangeSeq(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 20; i += 2 {
+		tree.Insert(i)
+	}
+	tests := []struct {
+		lo, hi    int
+		ascending bool
+		limit     int
+		want      []int
+	}{
+		{3, 9, true, 100, []int{4, 6, 8}},
+		{4, 8, true, 100, []int{4, 6, 8}},
+		{3, 9, false, 100, []int{8, 6, 4}},
+		{4, 8, false, 100, []int{8, 6, 4}},
+		{-5, 100, true, 2, []int{0, 2}},
+		{-5, 100, false, 2, []int{18, 16}},
+		{5, 5, true, 100, nil},
+		{6, 6, false, 100, []int{6}},
+		{9, 3, true, 100, nil},
+		{9, 3, false, 100, nil},
+		{19, 30, false, 100, nil},
+		{-3, -1, true, 100, nil},
+	}
+	for _, test := range tests {
+		var got []int
+		for v := range tree.RangeSeq(test.lo, test.hi, test.ascending) {
+			got = append(got, v)
+			if len(got) == test.limit {
+				break
+			}
+		}
+		if !equalInts(got, test.want) {
+			t.Errorf("RangeSeq(%d, %d, %v) yielded %v, want %v", test.lo, test.hi, test.ascending, got, test.want)
+		}
+	}
+}
+
+func TestWalkPrePostOrder(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	collect := func(walk func(func(*avl.Node) bool), limit int) []int {
+		var vals []int
+		walk(func(n *avl.Node) bool {
+			vals = append(vals, tree.Value(n))
+			return len(vals) < limit
+		})
+		return vals
+	}
+	if vals := collect(tree.WalkPreOrder, 100); vals != nil {
+		t.Errorf("WalkPreOrder of an empty tree visited %v", vals)
+	}
+	for i := 1; i <= 7; i++ {
+		tree.Insert(i)
+	}
+	tests := []struct {
+		name  string
+		walk  func(func(*avl.Node) bool)
+		limit int
+		want  []int
+	}{
+		{"WalkPreOrder", tree.WalkPreOrder, 100, []int{4, 2, 1, 3, 6, 5, 7}},
+		{"WalkPreOrder", tree.WalkPreOrder, 3, []int{4, 2, 1}},
+		{"WalkPostOrder", tree.WalkPostOrder, 100, []int{1, 3, 2, 5, 7, 6, 4}},
+		{"WalkPostOrder", tree.WalkPostOrder, 4, []int{1, 3, 2, 5}},
+	}
+	for _, test := range tests {
+		if got := collect(test.walk, test.limit); !equalInts(got, test.want) {
+			t.Errorf("%s visited %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCheckSortedUnique(t *testing.T) {
+	cmp := func(a, b int) int { return a - b }
+	for _, vals := range [][]int{nil, {1}, {1, 2, 5}} {
+		if err := avl.CheckSortedUnique(vals, cmp); err != nil {
+			t.Errorf("CheckSortedUnique(%v): %v", vals, err)
+		}
+	}
+	for _, test := range []struct {
+		vals []int
+		want string
+	}{
+		{[]int{1, 1}, "value 1, 1, does not follow 1"},
+		{[]int{1, 2, 3, 0}, "value 3, 0, does not follow 3"},
+	} {
+		err := avl.CheckSortedUnique(test.vals, cmp)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("CheckSortedUnique(%v) = %v, want %q", test.vals, err, test.want)
+		}
+	}
+}
+
+func TestNodeRoot(t *testing.T) {
+	tree := newRandIntTree(200, randMax, t)
+	root := tree.Root()
+	tree.Walk(func(n *avl.Node) bool {
+		if n.Root() != root {
+			t.Fatalf("Root of the Node holding %d is not the root of the tree", tree.Value(n))
+		}
+		return true
+	})
+	var n *avl.Node
+	if n.Root() != nil {
+		t.Errorf("Root of a nil Node is not nil")
+	}
+}
+
+func TestCacheLookups(t *testing.T) {
+	var cached, plain FullIntTree
+	if err := avl.Make(&cached, avl.CacheLookups(8)); err != nil {
+		t.Fatal(err)
+	}
+	avl.Make(&plain)
+	for i := 0; i < 20000; i++ {
+		k := rng.Intn(30)
+		switch rng.Intn(5) {
+		case 0:
+			cached.Insert(k)
+			plain.Insert(k)
+		case 1:
+			cached.Delete(k)
+			plain.Delete(k)
+		case 2:
+			to := rng.Intn(30)
+			cached.Move(k, to)
+			plain.Move(k, to)
+		default:
+			v1, ok1 := cached.Lookup(k)
+			v2, ok2 := plain.Lookup(k)
+			if v1 != v2 || ok1 != ok2 {
+				t.Fatalf("cached Lookup(%d) = %d, %v, want %d, %v", k, v1, ok1, v2, ok2)
+			}
+		}
+	}
+
+	var people People
+	if err := avl.Make(&people, avl.CacheLookups(8)); err != nil {
+		t.Errorf("CacheLookups of comparable structs: %v", err)
+	}
+	var slices SliceTree
+	if err := avl.Make(&slices, avl.CacheLookups(8)); err == nil {
+		t.Errorf("CacheLookups accepted an element type that is not comparable")
+	}
+}
+
+func TestCacheLookupsNaN(t *testing.T) {
+	const size = 4
+	var tree FloatTree
+	if err := avl.Make(&tree, avl.Multiset(), avl.CacheLookups(size)); err != nil {
+		t.Fatal(err)
+	}
+	// Compare finds NaN equal to everything, so every
+	// lookup of a NaN finds an element.
+	for i := 0; i < 10; i++ {
+		tree.Insert(float64(i))
+	}
+	for i := 0; i < 100; i++ {
+		if _, ok := tree.Lookup(math.NaN()); !ok {
+			t.Fatal("Lookup(NaN) found nothing")
+		}
+	}
+	if n := tree.CacheLen(); n > size {
+		t.Errorf("cache of size %d holds %d keys", size, n)
+	}
+}
+
+func TestCacheLookupsDynamicKeys(t *testing.T) {
+	var tree AnyTree
+	if err := avl.Make(&tree, avl.CacheLookups(8)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		tree.Insert(i)
+	}
+	tree.Insert([]int{10})
+	for i := 0; i < 2; i++ {
+		// An int key is cached.
+		if v, ok := tree.Lookup(3); !ok || v != 3 {
+			t.Errorf("Lookup(3) = %v, %v", v, ok)
+		}
+		// A slice key cannot be hashed, so it bypasses the cache.
+		if v, ok := tree.Lookup([]int{4}); !ok || v != 4 {
+			t.Errorf("Lookup([]int{4}) = %v, %v", v, ok)
+		}
+		if v, ok := tree.Lookup(10); !ok || anyKey(v) != 10 {
+			t.Errorf("Lookup(10) = %v, %v", v, ok)
+		}
+	}
+}
+
+func TestCacheLookupsSplitAt(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree, avl.CacheLookups(8))
+	for i := 0; i < 10; i++ {
+		tree.Insert(i)
+	}
+	tree.Lookup(3)
+	tree.SplitAt(5)
+	if _, ok := tree.Lookup(3); ok {
+		t.Errorf("Lookup found an element in a tree emptied by SplitAt")
+	}
+}
+
+func TestSizeStress(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 5000; i++ {
+		k := rng.Intn(500)
+		if rng.Intn(2) == 0 {
+			tree.Insert(k)
+		} else {
+			tree.Delete(k)
+		}
+		count := 0
+		tree.Walk(func(*avl.Node) bool {
+			count++
+			return true
+		})
+		if tree.Size() != count {
+			t.Fatalf("after %d operations Size is %d but the tree has %d nodes", i+1, tree.Size(), count)
+		}
+		if i%100 == 0 {
+			if err := tree.Validate(); err != nil {
+				t.Fatalf("after %d operations: %v", i+1, err)
+			}
+		}
+	}
+}
+
+func TestMinMaxStress(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	in := make(map[int]bool)
+	for i := 0; i < 5000; i++ {
+		k := rng.Intn(500)
+		switch rng.Intn(5) {
+		case 0, 1:
+			tree.Insert(k)
+			in[k] = true
+		case 2, 3:
+			tree.Delete(k)
+			delete(in, k)
+		case 4:
+			if min := tree.Min(); min != nil {
+				delete(in, tree.Value(min))
+			}
+			tree.RemoveMin()
+		}
+		min, max := -1, -1
+		for k := range in {
+			if min < 0 || k < min {
+				min = k
+			}
+			if max < 0 || k > max {
+				max = k
+			}
+		}
+		if len(in) == 0 {
+			if tree.Min() != nil || tree.Max() != nil {
+				t.Fatalf("after %d operations the tree is empty but Min or Max is not nil", i+1)
+			}
+			continue
+		}
+		if got := tree.Value(tree.Min()); got != min {
+			t.Fatalf("after %d operations Min is %d, want %d", i+1, got, min)
+		}
+		if got := tree.Value(tree.Max()); got != max {
+			t.Fatalf("after %d operations Max is %d, want %d", i+1, got, max)
+		}
+		if i%100 == 0 {
+			if err := tree.Validate(); err != nil {
+				t.Fatalf("after %d operations: %v", i+1, err)
+			}
+		}
+	}
+}
+
+func TestDropMaxN(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 100; i++ {
+		tree.Insert(i)
+	}
+	for _, tc := range []struct{ k, n, max int }{
+		{0, 0, 99},
+		{-1, 0, 99},
+		{30, 30, 69},
+		{1, 1, 68},
+		{100, 69, -1},
+	} {
+		if n := tree.DropMaxN(tc.k); n != tc.n {
+			t.Errorf("DropMaxN(%d) = %d, want %d", tc.k, n, tc.n)
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("after DropMaxN(%d): %v", tc.k, err)
+		}
+		max := -1
+		if n := tree.Max(); n != nil {
+			max = tree.Value(n)
+		}
+		if max != tc.max {
+			t.Errorf("after DropMaxN(%d) Max is %d, want %d", tc.k, max, tc.max)
+		}
+	}
+}
+
+func TestProvides(t *testing.T) {
+	var tree FloatTree
+	avl.Make(&tree)
+	if got, want := tree.Funcs(), []string{"Insert", "Lookup"}; !slices.Equal(got, want) {
+		t.Errorf("Funcs() = %q, want %q", got, want)
+	}
+	if !tree.Provides("Lookup") {
+		t.Error("Provides(\"Lookup\") = false")
+	}
+	if tree.Provides("Delete") {
+		t.Error("Provides(\"Delete\") = true")
+	}
+}
+
+func TestMakeTwice(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	tree.Insert(1)
+	if err := avl.Make(&tree); err == nil {
+		t.Error("second Make of a tree struct returned no error")
+	}
+	if tree.Size() != 1 {
+		t.Errorf("second Make of a tree struct reset it")
+	}
+
+	// An error leaves the other fields unset.
+	var partial FullIntTree
+	partial.Insert = func(int) {}
+	if err := avl.Make(&partial); err == nil {
+		t.Error("Make of a tree struct with Insert set returned no error")
+	}
+	if partial.Tree != nil || partial.Delete != nil || partial.Lookup != nil || partial.Keys != nil {
+		t.Error("Make set functions of a tree struct it returned an error for")
+	}
+}
+
+func TestLookupNode(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for i := 0; i < 10; i += 2 {
+		tree.Insert(i)
+	}
+	n, v, ok := tree.LookupNode(4)
+	if !ok || v != 4 || tree.Value(n) != 4 {
+		t.Fatalf("LookupNode(4) = %v, %d, %v", n, v, ok)
+	}
+	if next := tree.Value(n.Next()); next != 6 {
+		t.Errorf("Next of the Node found by LookupNode(4) holds %d, want 6", next)
+	}
+	if n, v, ok := tree.LookupNode(5); n != nil || v != 0 || ok {
+		t.Errorf("LookupNode(5) = %v, %d, %v, want nil, 0, false", n, v, ok)
+	}
+}
+
+func TestSizeOverwriteAndMissingDelete(t *testing.T) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	tree.Delete(1)
+	if tree.Size() != 0 {
+		t.Fatalf("Delete from an empty tree made Size %d", tree.Size())
+	}
+	for i := 0; i < 100; i += 2 {
+		tree.Insert(i)
+	}
+	for i := 0; i < 100; i += 2 {
+		tree.Insert(i)
+		if tree.Size() != 50 {
+			t.Fatalf("overwriting %d made Size %d, want 50", i, tree.Size())
+		}
+	}
+	for i := -1; i < 101; i += 2 {
+		tree.Delete(i)
+		if tree.Size() != 50 {
+			t.Fatalf("deleting missing %d made Size %d, want 50", i, tree.Size())
+		}
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type item struct {
+	key int
+}
+
+type ItemTree struct {
+	*avl.Tree
+	Insert     func(*item)
+	LookupNode func(*item) (*avl.Node, *item, bool)
+	Value      func(*avl.Node) *item
+}
+
+func (ItemTree) Compare(a, b *item) int {
+	return a.key - b.key
+}
+
+func (tree *ItemTree) SetTree(t *avl.Tree) {
+	tree.Tree = t
+}
+
+func TestResortNode(t *testing.T) {
+	var tree ItemTree
+	avl.MustMake(&tree)
+	for i := 0; i < 200; i++ {
+		tree.Insert(&item{2 * i})
+	}
+	for i := 0; i < 1000; i++ {
+		n, it, ok := tree.LookupNode(&item{2 * rng.Intn(200)})
+		if !ok {
+			t.Fatalf("lost an element")
+		}
+		orig := it.key
+		it.key = 2*rng.Intn(200) + 1
+		tree.ResortNode(n)
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("after changing a key to %d: %v", it.key, err)
+		}
+		if n.Deleted() || tree.Value(n) != it {
+			t.Fatalf("ResortNode did not keep the Node of %d", it.key)
+		}
+		it.key = orig
+		tree.ResortNode(n)
+	}
+	if tree.Size() != 200 {
+		t.Fatalf("Size is %d, want 200", tree.Size())
+	}
+
+	// Changing a key to that of another element
+	// replaces it.
+	n, it, _ := tree.LookupNode(&item{0})
+	it.key = 2
+	tree.ResortNode(n)
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !n.Deleted() || tree.Size() != 199 {
+		t.Errorf("ResortNode onto an existing key: Deleted is %v and Size is %d", n.Deleted(), tree.Size())
+	}
+	if _, got, _ := tree.LookupNode(&item{2}); got != it {
+		t.Errorf("ResortNode onto an existing key did not replace its element")
+	}
+}
@@ -0,0 +1,175 @@
+// Package avltest provides support for testing trees made
+// with avl.Make, and in particular their Compare methods,
+// against a simple reference implementation.
+package avltest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/spewspews/avl"
+)
+
+// Kind is the kind of operation performed by an Op.
+type Kind int
+
+// The kinds of operation that Check can replay.
+const (
+	Insert Kind = iota
+	Delete
+	Lookup
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Insert:
+		return "Insert"
+	case Delete:
+		return "Delete"
+	case Lookup:
+		return "Lookup"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// An Op is a single operation on a tree. Value must have the
+// element type of the tree or be nil for the zero value.
+type Op struct {
+	Kind  Kind
+	Value interface{}
+}
+
+func (op Op) String() string {
+	return fmt.Sprintf("%v(%v)", op.Kind, op.Value)
+}
+
+// tree is the part of the avl.Tree API used by Check. It is
+// satisfied by tree structs that embed *avl.Tree.
+type tree interface {
+	Validate() error
+	Size() int
+	Walk(func(*avl.Node) bool)
+}
+
+// Check replays ops on treeStruct and on a reference sorted
+// slice ordered by the same Compare method, and reports an
+// error through t at the first operation after which the two
+// disagree. After every operation it also calls Validate and
+// compares the full in-order contents of the tree with the
+// reference.
+//
+// The argument treeStruct must be a pointer to a struct that
+// has been passed to avl.Make without the Multiset option.
+// It must embed *avl.Tree, set through the avl.Setter
+// interface, and have the Insert, Delete, Lookup and Value
+// function fields.
+func Check(t testing.TB, treeStruct interface{}, ops []Op) {
+	t.Helper()
+
+	tr, ok := treeStruct.(tree)
+	if !ok {
+		t.Fatal("avltest: tree struct does not embed *avl.Tree")
+	}
+	tsVal := reflect.ValueOf(treeStruct)
+	var fns [4]reflect.Value
+	for i, name := range []string{"Insert", "Delete", "Lookup", "Value"} {
+		fns[i] = tsVal.Elem().FieldByName(name)
+		if !fns[i].IsValid() || fns[i].IsNil() {
+			t.Fatalf("avltest: tree struct has no %s function", name)
+		}
+	}
+	insert, delete, lookup, value := fns[0], fns[1], fns[2], fns[3]
+	elemType := insert.Type().In(0)
+	ref := reference{cmp: tsVal.MethodByName("Compare")}
+
+	for i, op := range ops {
+		v := reflect.ValueOf(op.Value)
+		if !v.IsValid() {
+			v = reflect.Zero(elemType)
+		}
+		if v.Type() != elemType {
+			t.Fatalf("avltest: op %d, %v: value has type %v, want %v", i, op, v.Type(), elemType)
+		}
+		args := []reflect.Value{v}
+		switch op.Kind {
+		case Insert:
+			insert.Call(args)
+			ref.insert(v)
+		case Delete:
+			delete.Call(args)
+			ref.delete(v)
+		case Lookup:
+			out := lookup.Call(args)
+			want, found := ref.lookup(v)
+			if out[1].Bool() != found {
+				t.Fatalf("avltest: op %d, %v: found is %v, want %v", i, op, out[1].Bool(), found)
+			}
+			if found && !reflect.DeepEqual(out[0].Interface(), want.Interface()) {
+				t.Fatalf("avltest: op %d, %v: got %v, want %v", i, op, out[0], want)
+			}
+		default:
+			t.Fatalf("avltest: op %d: unknown kind %v", i, op.Kind)
+		}
+
+		if err := tr.Validate(); err != nil {
+			t.Fatalf("avltest: op %d, %v: %v", i, op, err)
+		}
+		if tr.Size() != len(ref.vals) {
+			t.Fatalf("avltest: op %d, %v: tree has size %d, want %d", i, op, tr.Size(), len(ref.vals))
+		}
+		j := 0
+		tr.Walk(func(n *avl.Node) bool {
+			got := value.Call([]reflect.Value{reflect.ValueOf(n)})[0]
+			if !reflect.DeepEqual(got.Interface(), ref.vals[j].Interface()) {
+				t.Fatalf("avltest: op %d, %v: element %d is %v, want %v", i, op, j, got, ref.vals[j])
+			}
+			j++
+			return true
+		})
+	}
+}
+
+// reference is a sorted slice of distinct elements.
+type reference struct {
+	cmp  reflect.Value
+	vals []reflect.Value
+}
+
+func (r *reference) compare(a, b reflect.Value) int {
+	return int(r.cmp.Call([]reflect.Value{a, b})[0].Int())
+}
+
+// search returns the index at which v is or would be stored
+// and whether it is present.
+func (r *reference) search(v reflect.Value) (int, bool) {
+	i := sort.Search(len(r.vals), func(i int) bool {
+		return r.compare(r.vals[i], v) >= 0
+	})
+	return i, i < len(r.vals) && r.compare(r.vals[i], v) == 0
+}
+
+func (r *reference) insert(v reflect.Value) {
+	i, found := r.search(v)
+	if found {
+		r.vals[i] = v
+		return
+	}
+	r.vals = append(r.vals, reflect.Value{})
+	copy(r.vals[i+1:], r.vals[i:])
+	r.vals[i] = v
+}
+
+func (r *reference) delete(v reflect.Value) {
+	if i, found := r.search(v); found {
+		r.vals = append(r.vals[:i], r.vals[i+1:]...)
+	}
+}
+
+func (r *reference) lookup(v reflect.Value) (reflect.Value, bool) {
+	if i, found := r.search(v); found {
+		return r.vals[i], true
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,49 @@
+package avltest_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/spewspews/avl"
+	"github.com/spewspews/avl/avltest"
+)
+
+type StringTree struct {
+	*avl.Tree
+	Insert func(string)
+	Delete func(string)
+	Lookup func(string) (string, bool)
+	Value  func(*avl.Node) string
+}
+
+func (StringTree) Compare(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	default:
+		return 0
+	case a > b:
+		return 1
+	}
+}
+
+func (tree *StringTree) SetTree(t *avl.Tree) {
+	tree.Tree = t
+}
+
+func TestCheck(t *testing.T) {
+	var tree StringTree
+	if err := avl.Make(&tree); err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"", "a", "ab", "abc", "b", "ba", "c", "x", "xy", "z"}
+	ops := make([]avltest.Op, 500)
+	for i := range ops {
+		ops[i] = avltest.Op{
+			Kind:  avltest.Kind(rng.Intn(3)),
+			Value: words[rng.Intn(len(words))],
+		}
+	}
+	avltest.Check(t, &tree, ops)
+}
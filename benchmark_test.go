@@ -1,6 +1,10 @@
 package avl_test
 
 import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/emirpasic/gods/trees/avltree"
@@ -23,6 +27,53 @@ func BenchmarkLookup100000(b *testing.B) {
 	benchmarkLookup(b, 100000)
 }
 
+func BenchmarkLookupMany100000(b *testing.B) {
+	b.StopTimer()
+	var tree FullIntTree
+	avl.Make(&tree)
+	keys := make([]int, 100000)
+	for n := range keys {
+		tree.Insert(n)
+		keys[n] = n
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		tree.LookupMany(keys)
+	}
+}
+
+func BenchmarkInsert100(b *testing.B) {
+	benchmarkInsert(b, 100)
+}
+
+func BenchmarkInsert1000(b *testing.B) {
+	benchmarkInsert(b, 1000)
+}
+
+func BenchmarkInsert10000(b *testing.B) {
+	benchmarkInsert(b, 10000)
+}
+
+func BenchmarkInsert100000(b *testing.B) {
+	benchmarkInsert(b, 100000)
+}
+
+func BenchmarkDelete100(b *testing.B) {
+	benchmarkDelete(b, 100)
+}
+
+func BenchmarkDelete1000(b *testing.B) {
+	benchmarkDelete(b, 1000)
+}
+
+func BenchmarkDelete10000(b *testing.B) {
+	benchmarkDelete(b, 10000)
+}
+
+func BenchmarkDelete100000(b *testing.B) {
+	benchmarkDelete(b, 100000)
+}
+
 func BenchmarkGoDSGet100(b *testing.B) {
 	benchmarkGoDSGet(b, 100)
 }
@@ -41,7 +92,7 @@ func BenchmarkGoDSGet100000(b *testing.B) {
 
 func benchmarkLookup(b *testing.B, size int) {
 	b.StopTimer()
-	var tree IntTree
+	var tree FullIntTree
 	avl.Make(&tree)
 	for n := 0; n < size; n++ {
 		tree.Insert(n)
@@ -54,6 +105,33 @@ func benchmarkLookup(b *testing.B, size int) {
 	}
 }
 
+func benchmarkInsert(b *testing.B, size int) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		var tree FullIntTree
+		avl.Make(&tree)
+		b.StartTimer()
+		for n := 0; n < size; n++ {
+			tree.Insert(n)
+		}
+	}
+}
+
+func benchmarkDelete(b *testing.B, size int) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		var tree FullIntTree
+		avl.Make(&tree)
+		for n := 0; n < size; n++ {
+			tree.Insert(n)
+		}
+		b.StartTimer()
+		for n := 0; n < size; n++ {
+			tree.Delete(n)
+		}
+	}
+}
+
 func benchmarkGoDSGet(b *testing.B, size int) {
 	b.StopTimer()
 	tree := avltree.NewWithIntComparator()
@@ -67,3 +145,140 @@ func benchmarkGoDSGet(b *testing.B, size int) {
 		}
 	}
 }
+
+// CollatedTree orders strings case-insensitively with
+// a deliberately expensive Compare.
+type CollatedTree struct {
+	Insert func(string)
+	Lookup func(string) (string, bool)
+}
+
+func (CollatedTree) Compare(a, b string) int {
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func BenchmarkCollatedLookup(b *testing.B) {
+	benchmarkCollatedLookup(b)
+}
+
+func BenchmarkCollatedLookupMemoized(b *testing.B) {
+	benchmarkCollatedLookup(b, avl.MemoizeCompare(4096))
+}
+
+func benchmarkCollatedLookup(b *testing.B, opts ...avl.Option) {
+	b.StopTimer()
+	var tree CollatedTree
+	avl.Make(&tree, opts...)
+	prefix := strings.Repeat("Key", 100)
+	keys := make([]string, 1000)
+	for n := range keys {
+		keys[n] = fmt.Sprintf("%s%06d", prefix, n)
+		tree.Insert(keys[n])
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		for _, k := range keys[:100] {
+			tree.Lookup(k)
+		}
+	}
+}
+
+func BenchmarkFullIterationNext(b *testing.B) {
+	tree := fullIterationTree()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for n := tree.Min(); n != nil; n = n.Next() {
+		}
+	}
+}
+
+func BenchmarkFullIterationWalk(b *testing.B) {
+	tree := fullIterationTree()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Walk(func(*avl.Node) bool { return true })
+	}
+}
+
+func fullIterationTree() *FullIntTree {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for n := 0; n < 100000; n++ {
+		tree.Insert(n)
+	}
+	return &tree
+}
+
+func BenchmarkBuild1000000(b *testing.B) {
+	benchmarkBuild(b, 1000000, 0)
+}
+
+func BenchmarkParallelBuild1000000(b *testing.B) {
+	benchmarkBuild(b, 1000000, runtime.GOMAXPROCS(0))
+}
+
+func benchmarkBuild(b *testing.B, size, workers int) {
+	vals := make([]int, size)
+	for n := range vals {
+		vals[n] = n
+	}
+	for i := 0; i < b.N; i++ {
+		var tree FullIntTree
+		avl.Make(&tree)
+		if workers == 0 {
+			tree.AppendSorted(vals)
+		} else {
+			tree.ParallelBuild(vals, workers)
+		}
+	}
+}
+
+func BenchmarkZipfLookup(b *testing.B) {
+	benchmarkZipfLookup(b)
+}
+
+func BenchmarkZipfLookupCached(b *testing.B) {
+	benchmarkZipfLookup(b, avl.CacheLookups(64))
+}
+
+// benchmarkZipfLookup looks up keys of a tree of 100000
+// elements with a Zipfian distribution, so that a few keys
+// account for most lookups.
+func benchmarkZipfLookup(b *testing.B, opts ...avl.Option) {
+	b.StopTimer()
+	var tree FullIntTree
+	avl.Make(&tree, opts...)
+	for n := 0; n < 100000; n++ {
+		tree.Insert(n)
+	}
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.2, 1, 99999)
+	keys := make([]int, 100000)
+	for n := range keys {
+		keys[n] = int(zipf.Uint64())
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		for _, k := range keys {
+			tree.Lookup(k)
+		}
+	}
+}
+
+// BenchmarkWalkClosure walks with a function literal that
+// captures an accumulator. It should not allocate.
+func BenchmarkWalkClosure(b *testing.B) {
+	var tree FullIntTree
+	avl.Make(&tree)
+	for n := 0; n < 1000; n++ {
+		tree.Insert(n)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		tree.Walk(func(*avl.Node) bool {
+			count++
+			return true
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package avl
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+)
+
+// CacheLookups returns an Option that keeps the nodes found by
+// the last size distinct keys passed to Lookup, LookupNode,
+// LookupMany, GetOr, and Contains in a hash table checked
+// before searching the tree.
+// Finding a cached key costs hashing it and one call of Compare
+// to confirm that the cached Node still holds an equal element,
+// instead of one call per level of the tree, so this pays off
+// when a small set of hot keys accounts for most lookups. Keys
+// that are not found are not cached. Deleted nodes are detected
+// and dropped from the cache, so the results of lookups are the
+// same as without it. The element type must be comparable or
+// Make returns an error. If it is or contains an interface
+// type, keys holding values that are not comparable, such as
+// slices, are looked up in the tree without the cache, as are
+// keys that are not equal to themselves, such as NaNs.
+func CacheLookups(size int) Option {
+	return func(t *Tree) {
+		t.cacheSize = size
+	}
+}
+
+func (t *Tree) makeCache() error {
+	if !t.elemType.Comparable() {
+		return fmt.Errorf("CacheLookups requires a comparable element type, not %v", t.elemType)
+	}
+	t.cache = newLookupCache(t.cacheSize)
+	t.dynamicKeys = hasInterface(t.elemType)
+	return nil
+}
+
+// hasInterface reports whether values of typ may hold interface
+// values, whose dynamic types need not be comparable even
+// though typ is.
+func hasInterface(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Array:
+		return hasInterface(typ.Elem())
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			if hasInterface(typ.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lookupCache is a least recently used cache of the
+// nodes found by lookups.
+type lookupCache struct {
+	size int
+	lru  *list.List // of *cacheEntry, most recently used first
+	m    map[interface{}]*list.Element
+}
+
+type cacheEntry struct {
+	key interface{}
+	n   *Node
+}
+
+func newLookupCache(size int) *lookupCache {
+	return &lookupCache{
+		size: size,
+		lru:  list.New(),
+		m:    make(map[interface{}]*list.Element),
+	}
+}
+
+// find returns the node of t holding an element that
+// compares equal to val or nil if there is none.
+func (c *lookupCache) find(t *Tree, val reflect.Value) *Node {
+	if t.dynamicKeys && !val.Comparable() {
+		return t.find(val)
+	}
+	key := val.Interface()
+	if key != key {
+		// A key holding a NaN could never be found
+		// again or evicted.
+		return t.find(val)
+	}
+	if e, ok := c.m[key]; ok {
+		ce := e.Value.(*cacheEntry)
+		if !ce.n.deleted && t.cmp(val, ce.n.val) == 0 {
+			c.lru.MoveToFront(e)
+			return ce.n
+		}
+		// The Node was deleted or, by Move, given
+		// an element that is no longer equal.
+		delete(c.m, key)
+		c.lru.Remove(e)
+	}
+
+	n := t.find(val)
+	if n == nil {
+		return nil
+	}
+	if c.lru.Len() < c.size {
+		c.m[key] = c.lru.PushFront(&cacheEntry{key, n})
+		return n
+	}
+
+	// Reuse the least recently used entry.
+	e := c.lru.Back()
+	ce := e.Value.(*cacheEntry)
+	delete(c.m, ce.key)
+	ce.key, ce.n = key, n
+	c.m[key] = e
+	c.lru.MoveToFront(e)
+	return n
+}
@@ -0,0 +1,23 @@
+package avl
+
+// Chain returns a comparison function that orders its
+// arguments by the first of cmps that does not report them
+// equal. It is convenient for ordering structs by several
+// fields, as in
+//     var byName = avl.Chain(byLastName, byFirstName, byID)
+//
+//     func (People) Compare(a, b Person) int {
+//         return byName(a, b)
+//     }
+// and the result can be passed directly to the constructors
+// of package genericavl.
+func Chain[T any](cmps ...func(a, b T) int) func(a, b T) int {
+	return func(a, b T) int {
+		for _, cmp := range cmps {
+			if c := cmp(a, b); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+}
@@ -0,0 +1,145 @@
+// Avlgen writes the declaration of a tree struct for avl.Make.
+//
+// Since Make provides the function fields of a tree struct by
+// reflection, a misspelled field name or a wrong signature is
+// only noticed when the program runs, and a misspelled field is
+// silently left nil. Avlgen instead takes the names of the
+// functions wanted and writes a struct whose fields have exactly
+// the names and signatures Make provides, with the element type
+// substituted, so that code using the tree is checked by the
+// compiler. It also writes a SetTree method, so that the struct
+// embeds its *avl.Tree, and a constructor that calls MustMake.
+// The Compare method must be written by hand.
+//
+// Usage:
+//
+//	avlgen -type People -elem Person [-funcs Insert,Delete,Lookup,Value] [-pkg main] [-import path] [-o file]
+//
+// It is meant to be run by go generate:
+//
+//	//go:generate avlgen -type People -elem Person -o people_avl.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spewspews/avl"
+)
+
+type config struct {
+	typ, elem, pkg string
+	funcs          []string
+	imports        []string
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("avlgen: ")
+	var (
+		c       config
+		funcs   = flag.String("funcs", "Insert,Delete,Lookup,Value", "comma-separated `names` of the function fields")
+		imports = flag.String("import", "", "comma-separated import `paths` needed by the element type")
+		out     = flag.String("o", "", "output `file`; the default is standard output")
+	)
+	flag.StringVar(&c.typ, "type", "", "`name` of the tree struct")
+	flag.StringVar(&c.elem, "elem", "", "element `type`")
+	flag.StringVar(&c.pkg, "pkg", "", "package `name`; the default is $GOPACKAGE, or main")
+	flag.Parse()
+	if c.typ == "" || c.elem == "" || flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if c.pkg == "" {
+		c.pkg = os.Getenv("GOPACKAGE")
+	}
+	if c.pkg == "" {
+		c.pkg = "main"
+	}
+	c.funcs = split(*funcs)
+	c.imports = split(*imports)
+
+	var buf bytes.Buffer
+	if err := generate(&buf, c); err != nil {
+		log.Fatal(err)
+	}
+	if *out == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0666); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func split(s string) []string {
+	var l []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			l = append(l, f)
+		}
+	}
+	return l
+}
+
+// signature returns the type of the function field name of
+// avl.DummyTree, written with elem in place of avl.Dummy.
+// Reading the fields of DummyTree keeps avlgen in step with
+// the functions Make provides.
+func signature(name, elem string) (string, error) {
+	f, ok := reflect.TypeOf(avl.DummyTree{}).FieldByName(name)
+	if !ok || f.Type.Kind() != reflect.Func {
+		return "", fmt.Errorf("avl.Make provides no function %s", name)
+	}
+	return strings.ReplaceAll(f.Type.String(), "avl.Dummy", elem), nil
+}
+
+func generate(w io.Writer, c config) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by avlgen -type %s -elem %s; DO NOT EDIT.\n\n", c.typ, c.elem)
+	fmt.Fprintf(&b, "package %s\n\n", c.pkg)
+	fmt.Fprintf(&b, "import (\n")
+	for _, path := range c.imports {
+		fmt.Fprintf(&b, "\t%q\n", path)
+	}
+	fmt.Fprintf(&b, "\t%q\n)\n\n", "github.com/spewspews/avl")
+
+	fmt.Fprintf(&b, "// %s is an ordered collection of %s elements\n", c.typ, c.elem)
+	fmt.Fprintf(&b, "// whose functions are provided by avl.Make.\n")
+	fmt.Fprintf(&b, "type %s struct {\n\t*avl.Tree\n", c.typ)
+	seen := make(map[string]bool)
+	for _, name := range c.funcs {
+		if seen[name] {
+			return fmt.Errorf("function %s listed twice", name)
+		}
+		seen[name] = true
+		sig, err := signature(name, c.elem)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "\t%s %s\n", name, sig)
+	}
+	fmt.Fprintf(&b, "}\n\n")
+
+	fmt.Fprintf(&b, "// SetTree implements avl.Setter.\n")
+	fmt.Fprintf(&b, "func (tree *%s) SetTree(t *avl.Tree) {\n\ttree.Tree = t\n}\n\n", c.typ)
+
+	fmt.Fprintf(&b, "// New%s returns a new empty %s made with the given options.\n", c.typ, c.typ)
+	fmt.Fprintf(&b, "// It panics if avl.Make returns an error.\n")
+	fmt.Fprintf(&b, "func New%s(opts ...avl.Option) *%s {\n", c.typ, c.typ)
+	fmt.Fprintf(&b, "\ttree := new(%s)\n\tavl.MustMake(tree, opts...)\n\treturn tree\n}\n", c.typ)
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return fmt.Errorf("generated invalid Go: %v", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	var buf bytes.Buffer
+	err := generate(&buf, config{
+		typ:   "People",
+		elem:  "Person",
+		pkg:   "people",
+		funcs: []string{"Insert", "Delete", "Lookup", "Value", "LookupNode"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+	for _, want := range []string{
+		"package people\n",
+		"\tInsert     func(Person)\n",
+		"\tDelete     func(Person)\n",
+		"\tLookup     func(Person) (Person, bool)\n",
+		"\tValue      func(*avl.Node) Person\n",
+		"\tLookupNode func(Person) (*avl.Node, Person, bool)\n",
+		"func (tree *People) SetTree(t *avl.Tree) {",
+		"func NewPeople(opts ...avl.Option) *People {",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, src)
+		}
+	}
+}
+
+func TestGenerateUnknownFunc(t *testing.T) {
+	var buf bytes.Buffer
+	err := generate(&buf, config{typ: "People", elem: "Person", pkg: "main", funcs: []string{"Insrt"}})
+	if err == nil || !strings.Contains(err.Error(), "Insrt") {
+		t.Errorf("generate with a misspelled function returned %v", err)
+	}
+}
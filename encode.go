@@ -0,0 +1,118 @@
+package avl
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// The encoding written by Save starts with encodingMagic and a
+// version byte, followed by a gob stream holding the name of the
+// element type, the number of elements, and the elements in
+// ascending order. The version must be incremented whenever the
+// format changes so that Load rejects files it cannot read.
+const (
+	encodingMagic   = "AVLT"
+	encodingVersion = 1
+)
+
+// Save writes the elements of the Tree to w in ascending order
+// in a binary format that Load can read back. The elements are
+// encoded with encoding/gob, so their type must be encodable
+// by it.
+func (t *Tree) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(encodingMagic)
+	bw.WriteByte(encodingVersion)
+	enc := gob.NewEncoder(bw)
+	if err := enc.Encode(t.elemType.String()); err != nil {
+		return err
+	}
+	if err := enc.Encode(t.size); err != nil {
+		return err
+	}
+	for n := t.Min(); n != nil; n = n.Next() {
+		if err := enc.EncodeValue(n.val); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Load replaces the elements of the Tree with those written by
+// Save and links them into a perfectly balanced tree. The old
+// elements are passed to OnEvict. It returns an error, leaving
+// the Tree unchanged, if r does not hold a Tree written by a
+// compatible version of Save, if the elements are not of the
+// element type of the Tree, if they are not in order, or if
+// an Option such as RejectNaN rejects one of them.
+func (t *Tree) Load(r io.Reader) error {
+	br := bufio.NewReader(r)
+	var hdr [len(encodingMagic) + 1]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil || string(hdr[:len(encodingMagic)]) != encodingMagic {
+		return fmt.Errorf("avl: Load: not an encoded tree")
+	}
+	if v := hdr[len(encodingMagic)]; v != encodingVersion {
+		return fmt.Errorf("avl: Load: unsupported encoding version %d, want %d", v, encodingVersion)
+	}
+
+	dec := gob.NewDecoder(br)
+	var typ string
+	if err := dec.Decode(&typ); err != nil {
+		return fmt.Errorf("avl: Load: %v", err)
+	}
+	if typ != t.elemType.String() {
+		return fmt.Errorf("avl: Load: elements are of type %s, want %s", typ, t.elemType)
+	}
+	var size int
+	if err := dec.Decode(&size); err != nil {
+		return fmt.Errorf("avl: Load: %v", err)
+	}
+	if size < 0 {
+		return fmt.Errorf("avl: Load: invalid element count %d", size)
+	}
+
+	var nodes []*Node
+	for i := 0; i < size; i++ {
+		v := reflect.New(t.elemType).Elem()
+		if err := dec.DecodeValue(v); err != nil {
+			return fmt.Errorf("avl: Load: element %d: %v", i, err)
+		}
+		if err := t.check(v); err != nil {
+			return fmt.Errorf("avl: Load: element %d: %v", i, err)
+		}
+		if i > 0 {
+			prev := nodes[i-1].val
+			if !t.follows(v, prev) {
+				return fmt.Errorf("avl: Load: element %d, %v, does not follow %v", i, v, prev)
+			}
+		}
+		nodes = append(nodes, &Node{val: v})
+	}
+
+	old := t.root
+	t.root, _ = build(nodes, nil)
+	t.size = size
+	t.deleted = 0
+	t.resetExtremes()
+	t.discard(old)
+	return nil
+}
+
+// check returns the panic of the guard of t, if any, for v as
+// an error.
+func (t *Tree) check(v reflect.Value) (err error) {
+	if t.guard == nil {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s", strings.TrimPrefix(fmt.Sprint(r), "avl: "))
+		}
+	}()
+	t.guard(v)
+	return nil
+}
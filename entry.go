@@ -0,0 +1,29 @@
+package avl
+
+// Entry is a key-value pair for using a Tree as an ordered
+// map from keys of type K to values of type V. Order entries
+// by key alone with ByKey.
+type Entry[K, V any] struct {
+	Key K
+	Val V
+}
+
+// NewEntry returns an Entry mapping key to val.
+func NewEntry[K, V any](key K, val V) Entry[K, V] {
+	return Entry[K, V]{key, val}
+}
+
+// ByKey returns a comparison function that orders Entries
+// by comparing their keys with cmp, ignoring their values,
+// so that a Tree holds at most one Entry per key, as in
+//     var byKey = avl.ByKey[string, int](strings.Compare)
+//
+//     func (StringIntMap) Compare(a, b avl.Entry[string, int]) int {
+//         return byKey(a, b)
+//     }
+// Lookups can then pass an Entry with only the Key set.
+func ByKey[K, V any](cmp func(a, b K) int) func(a, b Entry[K, V]) int {
+	return func(a, b Entry[K, V]) int {
+		return cmp(a.Key, b.Key)
+	}
+}
@@ -0,0 +1,49 @@
+package avl_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spewspews/avl"
+)
+
+// EntryMap is StringIntMap of the package example
+// written with Entry and ByKey.
+type EntryMap struct {
+	Insert func(avl.Entry[string, int])
+	Delete func(avl.Entry[string, int])
+	Lookup func(avl.Entry[string, int]) (avl.Entry[string, int], bool)
+}
+
+var byKey = avl.ByKey[string, int](strings.Compare)
+
+func (EntryMap) Compare(a, b avl.Entry[string, int]) int {
+	return byKey(a, b)
+}
+
+func ExampleByKey() {
+	var m EntryMap
+	avl.MustMake(&m)
+
+	m.Insert(avl.NewEntry("foo", 10))
+	m.Insert(avl.NewEntry("bar", 11))
+	m.Insert(avl.NewEntry("foo", 20))
+
+	for _, key := range []string{"foo", "bar", "baz"} {
+		if e, ok := m.Lookup(avl.Entry[string, int]{Key: key}); ok {
+			fmt.Println(e.Key, e.Val)
+		} else {
+			fmt.Println(key, "not found")
+		}
+	}
+
+	m.Delete(avl.Entry[string, int]{Key: "foo"})
+	if _, ok := m.Lookup(avl.Entry[string, int]{Key: "foo"}); !ok {
+		fmt.Println("foo deleted")
+	}
+	// Output:
+	// foo 20
+	// bar 11
+	// baz not found
+	// foo deleted
+}
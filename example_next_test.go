@@ -52,3 +52,45 @@ func ExampleNode_Next() {
 	// 8
 	// 9
 }
+
+// TraceTree is an IntTree that can also trace insertions.
+type TraceTree struct {
+	*avl.Tree
+	Insert      func(int)
+	TraceInsert func(int) []string
+}
+
+func (TraceTree) Compare(a, b int) int {
+	return IntTree{}.Compare(a, b)
+}
+
+func (tree *TraceTree) SetTree(t *avl.Tree) {
+	tree.Tree = t
+}
+
+func Example_traceInsert() {
+	var t TraceTree
+	avl.Make(&t)
+	for _, i := range []int{10, 30, 20} {
+		t.Insert(i)
+	}
+	for _, step := range t.TraceInsert(25) {
+		fmt.Println(step)
+	}
+	for _, step := range t.TraceInsert(27) {
+		fmt.Println(step)
+	}
+
+	// Output:
+	// compare 25 with 20: greater
+	// compare 25 with 30: less
+	// insert 25 as the left child of 30
+	// 30 grew on the left: balance 0 -> -1
+	// 20 grew on the right: balance 0 -> 1
+	// compare 27 with 20: greater
+	// compare 27 with 30: less
+	// compare 27 with 25: greater
+	// insert 27 as the right child of 25
+	// 25 grew on the right: balance 0 -> 1
+	// 30 grew on the left: balance -1 -> -2, child 25 has balance 1, rotate left at 25 then right at 30 making 27 the subtree root
+}
@@ -44,8 +44,10 @@ func Example() {
 	var m StringIntMap
 	// This call provides the implementations of
 	// StringIntMap.Insert, StringIntMap.Delete, and
-	// StringIntMap.Lookup.
-	avl.Make(&m)
+	// StringIntMap.Lookup. MustMake panics if StringIntMap
+	// is malformed, for instance if Compare has the wrong
+	// signature.
+	avl.MustMake(&m)
 
 	// Type safety: the following will not compile
 	// m.Insert("foo")
@@ -0,0 +1,11 @@
+package avl
+
+// MemoLen and CacheLen expose the number of entries in the
+// comparison memo and the lookup cache to the tests.
+func (t *Tree) MemoLen() int {
+	return len(t.memo.m)
+}
+
+func (t *Tree) CacheLen() int {
+	return len(t.cache.m)
+}
@@ -0,0 +1,178 @@
+package genericavl_test
+
+import (
+	"cmp"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spewspews/avl"
+	"github.com/spewspews/avl/genericavl"
+)
+
+type IntTree struct {
+	Insert func(int)
+	Lookup func(int) (int, bool)
+}
+
+func (IntTree) Compare(a, b int) int {
+	return cmp.Compare(a, b)
+}
+
+func BenchmarkMapGet100(b *testing.B) {
+	benchmarkMapGet(b, 100)
+}
+
+func BenchmarkMapGet1000(b *testing.B) {
+	benchmarkMapGet(b, 1000)
+}
+
+func BenchmarkMapGet10000(b *testing.B) {
+	benchmarkMapGet(b, 10000)
+}
+
+func BenchmarkMapGet100000(b *testing.B) {
+	benchmarkMapGet(b, 100000)
+}
+
+func BenchmarkReflectLookup100(b *testing.B) {
+	benchmarkReflectLookup(b, 100)
+}
+
+func BenchmarkReflectLookup1000(b *testing.B) {
+	benchmarkReflectLookup(b, 1000)
+}
+
+func BenchmarkReflectLookup10000(b *testing.B) {
+	benchmarkReflectLookup(b, 10000)
+}
+
+func BenchmarkReflectLookup100000(b *testing.B) {
+	benchmarkReflectLookup(b, 100000)
+}
+
+func BenchmarkMapSet100000(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		m := genericavl.New[int, struct{}](cmp.Compare[int])
+		for n := 0; n < 100000; n++ {
+			m.Set(n, struct{}{})
+		}
+	}
+}
+
+func BenchmarkReflectInsert100000(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		var tree IntTree
+		avl.Make(&tree)
+		for n := 0; n < 100000; n++ {
+			tree.Insert(n)
+		}
+	}
+}
+
+func benchmarkMapGet(b *testing.B, size int) {
+	b.StopTimer()
+	m := genericavl.New[int, struct{}](cmp.Compare[int])
+	for n := 0; n < size; n++ {
+		m.Set(n, struct{}{})
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		for n := 0; n < size; n++ {
+			m.Get(n)
+		}
+	}
+}
+
+func benchmarkReflectLookup(b *testing.B, size int) {
+	b.StopTimer()
+	var tree IntTree
+	avl.Make(&tree)
+	for n := 0; n < size; n++ {
+		tree.Insert(n)
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		for n := 0; n < size; n++ {
+			tree.Lookup(n)
+		}
+	}
+}
+
+func BenchmarkMapGet1000000(b *testing.B) {
+	benchmarkMapGet(b, 1000000)
+}
+
+func BenchmarkFrozenMapGet1000000(b *testing.B) {
+	b.StopTimer()
+	m := genericavl.New[int, struct{}](cmp.Compare[int])
+	for n := 0; n < 1000000; n++ {
+		m.Set(n, struct{}{})
+	}
+	f := m.Freeze()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		for n := 0; n < 1000000; n++ {
+			f.Get(n)
+		}
+	}
+}
+
+// lockedMap is a Map guarded by a single lock,
+// for comparison with ShardedMap.
+type lockedMap struct {
+	mu sync.Mutex
+	m  *genericavl.Map[int, int]
+}
+
+func (l *lockedMap) Set(k, v int) {
+	l.mu.Lock()
+	l.m.Set(k, v)
+	l.mu.Unlock()
+}
+
+func BenchmarkLockedMapSetParallel(b *testing.B) {
+	m := &lockedMap{m: genericavl.New[int, int](cmp.Compare[int])}
+	benchmarkSetParallel(b, m.Set)
+}
+
+func BenchmarkShardedMapSetParallel(b *testing.B) {
+	m := genericavl.NewShardedMap[int, int](cmp.Compare[int], func(k int) uint64 {
+		return uint64(k) * 0x9e3779b97f4a7c15
+	}, 64)
+	benchmarkSetParallel(b, m.Set)
+}
+
+func benchmarkSetParallel(b *testing.B, set func(k, v int)) {
+	var seed atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		k := int(seed.Add(1) << 32)
+		for pb.Next() {
+			set(k%100000, k)
+			k += 7919
+		}
+	})
+}
+
+func BenchmarkSetUnion100000(b *testing.B) {
+	benchmarkSetAlgebra(b, (*genericavl.Set[int]).Union)
+}
+
+func BenchmarkSetIntersect100000(b *testing.B) {
+	benchmarkSetAlgebra(b, (*genericavl.Set[int]).Intersect)
+}
+
+// benchmarkSetAlgebra applies op to two sets of 100000
+// elements that have half their elements in common.
+func benchmarkSetAlgebra(b *testing.B, op func(s, other *genericavl.Set[int]) *genericavl.Set[int]) {
+	x := genericavl.NewSet(cmp.Compare[int])
+	y := genericavl.NewSet(cmp.Compare[int])
+	for n := 0; n < 100000; n++ {
+		x.Add(n)
+		y.Add(n + 50000)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		op(x, y)
+	}
+}
@@ -0,0 +1,67 @@
+package genericavl
+
+import (
+	"cmp"
+	"math/rand"
+	"testing"
+
+	"github.com/spewspews/avl"
+)
+
+// refTree is a tree of package avl, whose balancing code
+// package genericavl copies.
+type refTree struct {
+	*avl.Tree
+	Insert func(int)
+	Delete func(int)
+	Value  func(*avl.Node) int
+}
+
+func (refTree) Compare(a, b int) int {
+	return cmp.Compare(a, b)
+}
+
+func (r *refTree) SetTree(t *avl.Tree) {
+	r.Tree = t
+}
+
+// TestSameShape checks that a Set and a tree of package avl
+// put through the same insertions and deletions have the same
+// shape, so that the two copies of the balancing code agree.
+func TestSameShape(t *testing.T) {
+	var ref refTree
+	avl.MustMake(&ref)
+	s := NewSet(cmp.Compare[int])
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		k := rng.Intn(1000)
+		if rng.Intn(3) == 0 {
+			ref.Delete(k)
+			s.Remove(k)
+		} else {
+			ref.Insert(k)
+			s.Add(k)
+		}
+		if i%1000 == 0 || i == 19999 {
+			if path, ok := sameShape(s.t.root, ref.Root(), ref.Value, "root"); !ok {
+				t.Fatalf("after %d operations the trees differ at %s", i+1, path)
+			}
+		}
+	}
+	if s.Len() != ref.Size() {
+		t.Errorf("Set has %d elements, avl tree %d", s.Len(), ref.Size())
+	}
+}
+
+func sameShape(n *node[int], r *avl.Node, value func(*avl.Node) int, path string) (string, bool) {
+	if n == nil || r == nil {
+		return path, n == nil && r == nil
+	}
+	if n.val != value(r) {
+		return path, false
+	}
+	if p, ok := sameShape(n.c[0], r.Left(), value, path+".left"); !ok {
+		return p, false
+	}
+	return sameShape(n.c[1], r.Right(), value, path+".right")
+}
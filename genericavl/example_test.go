@@ -0,0 +1,55 @@
+package genericavl_test
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spewspews/avl/genericavl"
+)
+
+// This is the equivalent of the StringIntMap example of
+// package avl. No key-value struct or Compare method is
+// needed and no call can fail.
+func ExampleMap() {
+	m := genericavl.New[string, int](strings.Compare)
+	m.Set("foo", 10)
+	m.Set("bar", 11)
+
+	if v, ok := m.Get("foo"); ok {
+		fmt.Println(v)
+	}
+	m.Set("foo", 20)
+	if v, ok := m.Get("foo"); ok {
+		fmt.Println(v)
+	}
+
+	m.Delete("foo")
+	if _, ok := m.Get("foo"); !ok {
+		fmt.Println("foo deleted")
+	}
+
+	for k, v := range m.All() {
+		fmt.Println(k, v)
+	}
+	// Output:
+	// 10
+	// 20
+	// foo deleted
+	// bar 11
+}
+
+func ExampleSet() {
+	a := genericavl.NewSet(cmp.Compare[int])
+	b := genericavl.NewSet(cmp.Compare[int])
+	for i := 1; i <= 6; i++ {
+		a.Add(i)
+		b.Add(2 * i)
+	}
+	fmt.Println(slices.Collect(a.Intersect(b).All()))
+	fmt.Println(slices.Collect(a.Difference(b).Backward()))
+	// Output:
+	// [2 4 6]
+	// [5 3 1]
+}
@@ -0,0 +1,6 @@
+package genericavl
+
+// Validate exposes the tree invariant checks to the tests.
+func (s *Set[T]) Validate() error {
+	return s.t.validate()
+}
@@ -0,0 +1,118 @@
+package genericavl
+
+import "iter"
+
+// FrozenMap is a read-only copy of a Map laid out for fast
+// lookups. Its entries are stored in a single slice in the
+// order of a breadth-first walk of a complete binary search
+// tree, the Eytzinger layout, so the first levels of every
+// search share a few cache lines and no pointers are followed.
+type FrozenMap[K, V any] struct {
+	// a[1:] holds the entries; the children
+	// of a[i] are a[2*i] and a[2*i+1].
+	a   []entry[K, V]
+	cmp func(a, b entry[K, V]) int
+}
+
+// Freeze returns a FrozenMap holding the current mappings of
+// the Map. Later changes to the Map do not affect it.
+func (m *Map[K, V]) Freeze() *FrozenMap[K, V] {
+	f := &FrozenMap[K, V]{
+		a:   make([]entry[K, V], m.t.size+1),
+		cmp: m.t.cmp,
+	}
+	n := m.t.bottom(0)
+	var fill func(i int)
+	fill = func(i int) {
+		if i >= len(f.a) {
+			return
+		}
+		fill(2 * i)
+		f.a[i] = n.val
+		n = n.walk1(1)
+		fill(2*i + 1)
+	}
+	fill(1)
+	return f
+}
+
+// Get returns the value mapped to key and true, or the zero
+// value and false if key is not in the FrozenMap.
+func (f *FrozenMap[K, V]) Get(key K) (V, bool) {
+	e := entry[K, V]{key: key}
+	for i := 1; i < len(f.a); {
+		c := f.cmp(e, f.a[i])
+		if c == 0 {
+			return f.a[i].val, true
+		}
+		i = 2 * i
+		if c > 0 {
+			i++
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// Len returns the number of keys in the FrozenMap.
+func (f *FrozenMap[K, V]) Len() int {
+	return len(f.a) - 1
+}
+
+// Min returns the least key and its value and true, or zero
+// values and false if the FrozenMap is empty.
+func (f *FrozenMap[K, V]) Min() (K, V, bool) {
+	return f.extreme(0)
+}
+
+// Max returns the greatest key and its value and true, or
+// zero values and false if the FrozenMap is empty.
+func (f *FrozenMap[K, V]) Max() (K, V, bool) {
+	return f.extreme(1)
+}
+
+func (f *FrozenMap[K, V]) extreme(d int) (K, V, bool) {
+	if len(f.a) == 1 {
+		var e entry[K, V]
+		return e.key, e.val, false
+	}
+	i := 1
+	for 2*i+d < len(f.a) {
+		i = 2*i + d
+	}
+	return f.a[i].key, f.a[i].val, true
+}
+
+// All returns an iterator over the key-value pairs of the
+// FrozenMap in ascending order of key.
+func (f *FrozenMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		n := len(f.a)
+		i := 1
+		if i >= n {
+			return
+		}
+		for 2*i < n {
+			i = 2 * i
+		}
+		for i > 0 {
+			if !yield(f.a[i].key, f.a[i].val) {
+				return
+			}
+			// Step to the in-order successor: the leftmost
+			// node of the right subtree, or else the first
+			// ancestor of which i is in the left subtree.
+			if 2*i+1 < n {
+				i = 2*i + 1
+				for 2*i < n {
+					i = 2 * i
+				}
+			} else {
+				for i&1 == 1 {
+					i >>= 1
+				}
+				i >>= 1
+			}
+		}
+	}
+}
@@ -0,0 +1,401 @@
+// Package genericavl implements ordered collections on an AVL
+// balanced binary tree using type parameters. It is the
+// reflection-free counterpart of package avl: the balancing
+// algorithms are the same, but elements are stored and compared
+// with their static types.
+//
+// The balancing code is a deliberate copy of that of package
+// avl rather than a front end to it. Package avl holds its
+// elements in reflect.Values and calls Compare by reflection,
+// which is the cost this package exists to avoid, so the two
+// cannot share nodes. A fix to the insertion, deletion or
+// rotation code of either package must be made in both. A
+// test puts a Set and an avl tree through the same operations
+// and checks that they keep the same shape.
+//
+// The collections are not safe for concurrent use.
+package genericavl
+
+import "fmt"
+
+// node is a node of the balanced tree.
+type node[T any] struct {
+	val T
+	c   [2]*node[T]
+	p   *node[T]
+	b   int8
+}
+
+// tree is the balanced tree underlying the collections.
+type tree[T any] struct {
+	root *node[T]
+	size int
+	cmp  func(a, b T) int
+}
+
+func (t *tree[T]) compare(a, b T) int8 {
+	r := t.cmp(a, b)
+	switch {
+	case r < 0:
+		return -1
+	default:
+		return 0
+	case r > 0:
+		return 1
+	}
+}
+
+// find returns the node holding an element that compares
+// equal to val or nil if there is none.
+func (t *tree[T]) find(val T) *node[T] {
+	n := t.root
+	for n != nil {
+		switch t.compare(val, n.val) {
+		case -1:
+			n = n.c[0]
+		case 0:
+			return n
+		case 1:
+			n = n.c[1]
+		}
+	}
+	return nil
+}
+
+// lowerBound returns the first node whose element does not
+// compare less than val or nil if there is none.
+func (t *tree[T]) lowerBound(val T) *node[T] {
+	var lb *node[T]
+	n := t.root
+	for n != nil {
+		if t.compare(val, n.val) <= 0 {
+			lb = n
+			n = n.c[0]
+		} else {
+			n = n.c[1]
+		}
+	}
+	return lb
+}
+
+// floor returns the last node whose element does not
+// compare greater than val or nil if there is none.
+func (t *tree[T]) floor(val T) *node[T] {
+	var fl *node[T]
+	n := t.root
+	for n != nil {
+		if t.compare(n.val, val) <= 0 {
+			fl = n
+			n = n.c[1]
+		} else {
+			n = n.c[0]
+		}
+	}
+	return fl
+}
+
+func (t *tree[T]) bottom(d int) *node[T] {
+	n := t.root
+	if n == nil {
+		return nil
+	}
+
+	for c := n.c[d]; c != nil; c = n.c[d] {
+		n = c
+	}
+	return n
+}
+
+// walk1 returns the next node in direction a of an in-order walk.
+func (n *node[T]) walk1(a int) *node[T] {
+	if n == nil {
+		return nil
+	}
+
+	if n.c[a] != nil {
+		n = n.c[a]
+		for n.c[a^1] != nil {
+			n = n.c[a^1]
+		}
+		return n
+	}
+
+	p := n.p
+	for p != nil && p.c[a] == n {
+		n = p
+		p = p.p
+	}
+	return p
+}
+
+// insert stores val in the tree, replacing any element that
+// compares equal to it, and reports whether val was added.
+func (t *tree[T]) insert(val T) bool {
+	size := t.size
+	t.insert1(val, nil, &t.root)
+	return t.size > size
+}
+
+func (t *tree[T]) insert1(val T, p *node[T], qp **node[T]) bool {
+	q := *qp
+	if q == nil {
+		t.size++
+		*qp = &node[T]{val: val, p: p}
+		return true
+	}
+
+	c := t.compare(val, q.val)
+	if c == 0 {
+		q.val = val
+		return false
+	}
+
+	a := (c + 1) / 2
+	fix := t.insert1(val, q, &q.c[a])
+	if fix {
+		return insertFix(c, qp)
+	}
+	return false
+}
+
+func insertFix[T any](c int8, t **node[T]) bool {
+	s := *t
+	if s.b == 0 {
+		s.b = c
+		return true
+	}
+
+	if s.b == -c {
+		s.b = 0
+		return false
+	}
+
+	if s.c[(c+1)/2].b == c {
+		s = singlerot(c, s)
+	} else {
+		s = doublerot(c, s)
+	}
+	*t = s
+	return false
+}
+
+// delete removes the element that compares equal to val and
+// reports whether there was one.
+func (t *tree[T]) delete(val T) bool {
+	size := t.size
+	t.delete1(val, &t.root)
+	return t.size < size
+}
+
+func (t *tree[T]) delete1(val T, qp **node[T]) bool {
+	q := *qp
+	if q == nil {
+		return false
+	}
+
+	c := t.compare(val, q.val)
+	if c == 0 {
+		t.size--
+		if q.c[1] == nil {
+			if q.c[0] != nil {
+				q.c[0].p = q.p
+			}
+			*qp = q.c[0]
+			return true
+		}
+		fix := deleteMin(&q.c[1], &q.val)
+		if fix {
+			return deleteFix(-1, qp)
+		}
+		return false
+	}
+	a := (c + 1) / 2
+	fix := t.delete1(val, &q.c[a])
+	if fix {
+		return deleteFix(-c, qp)
+	}
+	return false
+}
+
+func deleteMin[T any](qp **node[T], min *T) bool {
+	q := *qp
+	if q.c[0] == nil {
+		*min = q.val
+		if q.c[1] != nil {
+			q.c[1].p = q.p
+		}
+		*qp = q.c[1]
+		return true
+	}
+	fix := deleteMin(&q.c[0], min)
+	if fix {
+		return deleteFix(1, qp)
+	}
+	return false
+}
+
+func deleteFix[T any](c int8, t **node[T]) bool {
+	s := *t
+	if s.b == 0 {
+		s.b = c
+		return false
+	}
+
+	if s.b == -c {
+		s.b = 0
+		return true
+	}
+
+	a := (c + 1) / 2
+	if s.c[a].b == 0 {
+		s = rotate(c, s)
+		s.b = -c
+		*t = s
+		return false
+	}
+
+	if s.c[a].b == c {
+		s = singlerot(c, s)
+	} else {
+		s = doublerot(c, s)
+	}
+	*t = s
+	return true
+}
+
+func singlerot[T any](c int8, s *node[T]) *node[T] {
+	s.b = 0
+	s = rotate(c, s)
+	s.b = 0
+	return s
+}
+
+func doublerot[T any](c int8, s *node[T]) *node[T] {
+	a := (c + 1) / 2
+	r := s.c[a]
+	s.c[a] = rotate(-c, s.c[a])
+	p := rotate(c, s)
+
+	switch {
+	default:
+		s.b = 0
+		r.b = 0
+	case p.b == c:
+		s.b = -c
+		r.b = 0
+	case p.b == -c:
+		s.b = 0
+		r.b = c
+	}
+
+	p.b = 0
+	return p
+}
+
+func rotate[T any](c int8, s *node[T]) *node[T] {
+	a := (c + 1) / 2
+	r := s.c[a]
+	s.c[a] = r.c[a^1]
+	if s.c[a] != nil {
+		s.c[a].p = s
+	}
+	r.c[a^1] = s
+	r.p = s.p
+	s.p = r
+	return r
+}
+
+// height returns the height of the subtree rooted at n by
+// following the balance factors down its taller side.
+func height[T any](n *node[T]) int {
+	h := 0
+	for ; n != nil; h++ {
+		if n.b < 0 {
+			n = n.c[0]
+		} else {
+			n = n.c[1]
+		}
+	}
+	return h
+}
+
+// build links the ordered elements into a perfectly balanced
+// tree with parent p and returns its root and height.
+func build[T any](vals []T, p *node[T]) (*node[T], int) {
+	if len(vals) == 0 {
+		return nil, 0
+	}
+
+	m := len(vals) / 2
+	n := &node[T]{val: vals[m], p: p}
+	var hl, hr int
+	n.c[0], hl = build(vals[:m], n)
+	n.c[1], hr = build(vals[m+1:], n)
+	n.b = int8(hr - hl)
+	if hl > hr {
+		return n, hl + 1
+	}
+	return n, hr + 1
+}
+
+// clone returns a copy of the subtree rooted at n
+// with parent p.
+func clone[T any](n, p *node[T]) *node[T] {
+	if n == nil {
+		return nil
+	}
+	c := &node[T]{val: n.val, p: p, b: n.b}
+	c.c[0] = clone(n.c[0], c)
+	c.c[1] = clone(n.c[1], c)
+	return c
+}
+
+// validate checks the links, balance factors, order, and
+// size of the tree and returns an error describing the first
+// violation found or nil.
+func (t *tree[T]) validate() error {
+	if t.root != nil && t.root.p != nil {
+		return fmt.Errorf("genericavl: root %v has a parent", t.root.val)
+	}
+	size, _, err := t.validate1(t.root)
+	if err != nil {
+		return err
+	}
+	if size != t.size {
+		return fmt.Errorf("genericavl: tree has %d nodes but its size is %d", size, t.size)
+	}
+	for n := t.bottom(0); n != nil; n = n.walk1(1) {
+		if next := n.walk1(1); next != nil && t.compare(n.val, next.val) >= 0 {
+			return fmt.Errorf("genericavl: node %v is out of order with its successor %v", n.val, next.val)
+		}
+	}
+	return nil
+}
+
+// validate1 checks the subtree rooted at n and returns its
+// size and height.
+func (t *tree[T]) validate1(n *node[T]) (int, int, error) {
+	if n == nil {
+		return 0, 0, nil
+	}
+	for _, c := range n.c {
+		if c != nil && c.p != n {
+			return 0, 0, fmt.Errorf("genericavl: node %v has child %v with the wrong parent", n.val, c.val)
+		}
+	}
+	sl, hl, err := t.validate1(n.c[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	sr, hr, err := t.validate1(n.c[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	if d := hr - hl; d < -1 || d > 1 || int(n.b) != d {
+		return 0, 0, fmt.Errorf("genericavl: node %v has balance %d but its subtrees differ in height by %d", n.val, n.b, d)
+	}
+	if hl > hr {
+		return sl + sr + 1, hl + 1, nil
+	}
+	return sl + sr + 1, hr + 1, nil
+}
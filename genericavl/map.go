@@ -0,0 +1,129 @@
+package genericavl
+
+import "iter"
+
+// Map is an ordered map from keys of type K to values of
+// type V. The zero Map is not usable; create Maps with New.
+type Map[K, V any] struct {
+	t tree[entry[K, V]]
+}
+
+type entry[K, V any] struct {
+	key K
+	val V
+}
+
+// New returns an empty Map whose keys are ordered by cmp,
+// which should return an integer less than, equal to, or
+// greater than 0 as a is less than, equal to, or greater than b.
+func New[K, V any](cmp func(a, b K) int) *Map[K, V] {
+	m := new(Map[K, V])
+	m.t.cmp = func(a, b entry[K, V]) int {
+		return cmp(a.key, b.key)
+	}
+	return m
+}
+
+// Set maps key to val, replacing any previous mapping of key.
+func (m *Map[K, V]) Set(key K, val V) {
+	m.t.insert(entry[K, V]{key, val})
+}
+
+// Get returns the value mapped to key and true, or the zero
+// value and false if key is not in the Map.
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	if n := m.t.find(entry[K, V]{key: key}); n != nil {
+		return n.val.val, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Floor returns the greatest key that does not compare
+// greater than key, its value, and true, or zero values and
+// false if every key compares greater.
+func (m *Map[K, V]) Floor(key K) (K, V, bool) {
+	if n := m.t.floor(entry[K, V]{key: key}); n != nil {
+		return n.val.key, n.val.val, true
+	}
+	var e entry[K, V]
+	return e.key, e.val, false
+}
+
+// Ceiling returns the least key that does not compare less
+// than key, its value, and true, or zero values and false if
+// every key compares less.
+func (m *Map[K, V]) Ceiling(key K) (K, V, bool) {
+	if n := m.t.lowerBound(entry[K, V]{key: key}); n != nil {
+		return n.val.key, n.val.val, true
+	}
+	var e entry[K, V]
+	return e.key, e.val, false
+}
+
+// Delete removes the mapping of key and reports whether
+// there was one.
+func (m *Map[K, V]) Delete(key K) bool {
+	return m.t.delete(entry[K, V]{key: key})
+}
+
+// Len returns the number of keys in the Map.
+func (m *Map[K, V]) Len() int {
+	return m.t.size
+}
+
+// Clear removes every mapping from the Map.
+func (m *Map[K, V]) Clear() {
+	m.t.root, m.t.size = nil, 0
+}
+
+// Clone returns a copy of the Map that is independent of it.
+// The keys and values are copied by assignment. Clone takes
+// O(n) time.
+func (m *Map[K, V]) Clone() *Map[K, V] {
+	c := &Map[K, V]{t: m.t}
+	c.t.root = clone(m.t.root, nil)
+	return c
+}
+
+// Stats describes the shape of a collection.
+type Stats struct {
+	// Len is the number of elements.
+	Len int
+
+	// Height is the number of nodes on the longest path
+	// from the root to a leaf.
+	Height int
+}
+
+// Stats returns the number of elements in the Map and the
+// height of its tree. It takes O(log n) time.
+func (m *Map[K, V]) Stats() Stats {
+	return Stats{Len: m.t.size, Height: height(m.t.root)}
+}
+
+// All returns an iterator over the key-value pairs of the Map
+// in ascending order of key.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for n := m.t.bottom(0); n != nil; n = n.walk1(1) {
+			if !yield(n.val.key, n.val.val) {
+				return
+			}
+		}
+	}
+}
+
+// Range returns an iterator over the key-value pairs of the
+// Map with keys from lo to hi inclusive, in ascending order
+// of key. It is empty if lo is greater than hi.
+func (m *Map[K, V]) Range(lo, hi K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		end := entry[K, V]{key: hi}
+		for n := m.t.lowerBound(entry[K, V]{key: lo}); n != nil && m.t.compare(n.val, end) <= 0; n = n.walk1(1) {
+			if !yield(n.val.key, n.val.val) {
+				return
+			}
+		}
+	}
+}
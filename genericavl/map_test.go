@@ -0,0 +1,267 @@
+package genericavl_test
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/spewspews/avl/genericavl"
+)
+
+func TestMap(t *testing.T) {
+	m := genericavl.New[int, string](cmp.Compare[int])
+	ref := make(map[int]string)
+	for i := 0; i < 5000; i++ {
+		k := rand.Intn(500)
+		switch rand.Intn(3) {
+		case 0:
+			v := fmt.Sprint(i)
+			m.Set(k, v)
+			ref[k] = v
+		case 1:
+			_, want := ref[k]
+			if got := m.Delete(k); got != want {
+				t.Fatalf("Delete(%d) = %v, want %v", k, got, want)
+			}
+			delete(ref, k)
+		case 2:
+			v, ok := m.Get(k)
+			want, wantOk := ref[k]
+			if v != want || ok != wantOk {
+				t.Fatalf("Get(%d) = %q, %v; want %q, %v", k, v, ok, want, wantOk)
+			}
+		}
+		if m.Len() != len(ref) {
+			t.Fatalf("Len is %d, want %d", m.Len(), len(ref))
+		}
+	}
+
+	prev, n := -1, 0
+	for k, v := range m.All() {
+		if k <= prev {
+			t.Fatalf("All out of order: %d after %d", k, prev)
+		}
+		if v != ref[k] {
+			t.Fatalf("All yielded %d: %q, want %q", k, v, ref[k])
+		}
+		prev = k
+		n++
+	}
+	if n != len(ref) {
+		t.Errorf("All yielded %d pairs, want %d", n, len(ref))
+	}
+}
+
+func TestMapRange(t *testing.T) {
+	m := genericavl.New[int, int](cmp.Compare[int])
+	for i := 0; i < 20; i += 2 {
+		m.Set(i, i*i)
+	}
+	tests := []struct {
+		lo, hi int
+		want   []int
+	}{
+		{3, 9, []int{4, 6, 8}},
+		{4, 8, []int{4, 6, 8}},
+		{-10, 2, []int{0, 2}},
+		{17, 100, []int{18}},
+		{9, 3, nil},
+	}
+	for _, test := range tests {
+		var got []int
+		for k, v := range m.Range(test.lo, test.hi) {
+			if v != k*k {
+				t.Errorf("Range(%d, %d) yielded %d: %d", test.lo, test.hi, k, v)
+			}
+			got = append(got, k)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("Range(%d, %d) yielded %v, want %v", test.lo, test.hi, got, test.want)
+		}
+	}
+	for k := range m.Range(0, 100) {
+		if k > 4 {
+			t.Fatal("Range did not stop at break")
+		}
+		if k == 4 {
+			break
+		}
+	}
+}
+
+func TestMapStats(t *testing.T) {
+	m := genericavl.New[int, struct{}](cmp.Compare[int])
+	if s := m.Stats(); s != (genericavl.Stats{}) {
+		t.Errorf("Stats of an empty Map = %+v", s)
+	}
+	for i := 0; i < 1023; i++ {
+		m.Set(i, struct{}{})
+	}
+	// Inserting in order fills every level of the tree
+	// before starting a new one.
+	if s := m.Stats(); s != (genericavl.Stats{Len: 1023, Height: 10}) {
+		t.Errorf("Stats = %+v, want {Len:1023 Height:10}", s)
+	}
+}
+
+func TestMapClear(t *testing.T) {
+	m := genericavl.New[int, int](cmp.Compare[int])
+	for i := 0; i < 10; i++ {
+		m.Set(i, i)
+	}
+	m.Clear()
+	if _, ok := m.Get(3); ok || m.Len() != 0 {
+		t.Fatalf("after Clear Len is %d", m.Len())
+	}
+	m.Set(3, 9)
+	if v, ok := m.Get(3); !ok || v != 9 || m.Len() != 1 {
+		t.Errorf("after Clear and Set(3, 9), Get(3) = %d, %v and Len is %d", v, ok, m.Len())
+	}
+}
+
+func TestMapClone(t *testing.T) {
+	m := genericavl.New[int, int](cmp.Compare[int])
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	c := m.Clone()
+	m.Set(1, -1)
+	m.Delete(2)
+	if v, ok := c.Get(1); !ok || v != 1 {
+		t.Errorf("clone Get(1) = %d, %v, want 1, true", v, ok)
+	}
+	if _, ok := c.Get(2); !ok || c.Len() != 100 {
+		t.Errorf("deleting from a Map deleted from its clone")
+	}
+}
+
+func TestMapFloor(t *testing.T) {
+	m := genericavl.New[int, string](cmp.Compare[int])
+	if k, v, ok := m.Floor(5); k != 0 || v != "" || ok {
+		t.Errorf("Floor(5) of an empty Map = %d, %q, %v", k, v, ok)
+	}
+	m.Set(10, "ten")
+	m.Set(20, "twenty")
+	if k, v, ok := m.Floor(15); k != 10 || v != "ten" || !ok {
+		t.Errorf("Floor(15) = %d, %q, %v, want 10, \"ten\", true", k, v, ok)
+	}
+	if k, v, ok := m.Floor(20); k != 20 || v != "twenty" || !ok {
+		t.Errorf("Floor(20) = %d, %q, %v, want 20, \"twenty\", true", k, v, ok)
+	}
+	if _, _, ok := m.Floor(9); ok {
+		t.Errorf("Floor(9) found a key")
+	}
+}
+
+func TestMapCeiling(t *testing.T) {
+	m := genericavl.New[int, string](cmp.Compare[int])
+	m.Set(10, "ten")
+	m.Set(20, "twenty")
+	if k, v, ok := m.Ceiling(15); k != 20 || v != "twenty" || !ok {
+		t.Errorf("Ceiling(15) = %d, %q, %v, want 20, \"twenty\", true", k, v, ok)
+	}
+	if k, v, ok := m.Ceiling(10); k != 10 || v != "ten" || !ok {
+		t.Errorf("Ceiling(10) = %d, %q, %v, want 10, \"ten\", true", k, v, ok)
+	}
+	if _, _, ok := m.Ceiling(21); ok {
+		t.Errorf("Ceiling(21) found a key")
+	}
+}
+
+func TestFrozenMap(t *testing.T) {
+	for _, size := range []int{0, 1, 2, 3, 7, 8, 100, 1000} {
+		m := genericavl.New[int, int](cmp.Compare[int])
+		for _, k := range rand.Perm(size) {
+			m.Set(2*k, k)
+		}
+		f := m.Freeze()
+		m.Set(-1, -1)
+		if f.Len() != size {
+			t.Fatalf("Len = %d, want %d", f.Len(), size)
+		}
+		for k := -1; k <= 2*size; k++ {
+			v, ok := f.Get(k)
+			if wantOk := k >= 0 && k%2 == 0 && k < 2*size; ok != wantOk || ok && v != k/2 {
+				t.Fatalf("Get(%d) in a FrozenMap of %d = %d, %v", k, size, v, ok)
+			}
+		}
+		i := 0
+		for k, v := range f.All() {
+			if k != 2*i || v != i {
+				t.Fatalf("All of a FrozenMap of %d yielded %d, %d at %d", size, k, v, i)
+			}
+			i++
+		}
+		if i != size {
+			t.Fatalf("All of a FrozenMap of %d yielded %d pairs", size, i)
+		}
+		min, _, minOk := f.Min()
+		max, _, maxOk := f.Max()
+		if size == 0 {
+			if minOk || maxOk {
+				t.Errorf("Min or Max of an empty FrozenMap succeeded")
+			}
+		} else if min != 0 || max != 2*(size-1) || !minOk || !maxOk {
+			t.Errorf("Min, Max of a FrozenMap of %d = %d, %d", size, min, max)
+		}
+	}
+}
+
+func TestMapLenOverwriteAndMissingDelete(t *testing.T) {
+	m := genericavl.New[int, int](cmp.Compare[int])
+	for i := 0; i < 100; i++ {
+		m.Set(i%10, i)
+		m.Delete(10 + i)
+	}
+	if m.Len() != 10 {
+		t.Errorf("Len is %d, want 10", m.Len())
+	}
+}
+
+func hashInt(k int) uint64 {
+	return uint64(k) * 0x9e3779b97f4a7c15
+}
+
+func TestShardedMap(t *testing.T) {
+	s := genericavl.NewShardedMap[int, int](cmp.Compare[int], hashInt, 8)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := g*1000 + i
+				s.Set(k, -k)
+				if i%2 == 1 {
+					s.Delete(k)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if s.Len() != 4000 {
+		t.Fatalf("Len is %d, want 4000", s.Len())
+	}
+	for k := 0; k < 8000; k++ {
+		v, ok := s.Get(k)
+		if ok != (k%2 == 0) || ok && v != -k {
+			t.Fatalf("Get(%d) = %d, %v", k, v, ok)
+		}
+	}
+	want := 100
+	for k, v := range s.Range(99, 1099) {
+		if k != want || v != -k {
+			t.Fatalf("Range(99, 1099) yielded %d, %d, want %d, %d", k, v, want, -want)
+		}
+		want += 2
+		if want == 300 {
+			break
+		}
+	}
+	if want != 300 {
+		t.Fatalf("Range(99, 1099) stopped at %d", want)
+	}
+}
@@ -0,0 +1,194 @@
+package genericavl
+
+import "iter"
+
+// Set is an ordered set of elements of type T. The zero Set
+// is not usable; create Sets with NewSet.
+type Set[T any] struct {
+	t tree[T]
+}
+
+// NewSet returns an empty Set whose elements are ordered by
+// cmp, which should return an integer less than, equal to, or
+// greater than 0 as a is less than, equal to, or greater than b.
+func NewSet[T any](cmp func(a, b T) int) *Set[T] {
+	s := new(Set[T])
+	s.t.cmp = cmp
+	return s
+}
+
+// Add adds v to the Set, replacing any element that compares
+// equal to it, and reports whether the Set grew.
+func (s *Set[T]) Add(v T) bool {
+	return s.t.insert(v)
+}
+
+// Remove removes the element that compares equal to v and
+// reports whether there was one.
+func (s *Set[T]) Remove(v T) bool {
+	return s.t.delete(v)
+}
+
+// Contains reports whether the Set holds an element that
+// compares equal to v.
+func (s *Set[T]) Contains(v T) bool {
+	return s.t.find(v) != nil
+}
+
+// Floor returns the greatest element that does not compare
+// greater than v and true, or the zero value and false if
+// every element compares greater.
+func (s *Set[T]) Floor(v T) (T, bool) {
+	if n := s.t.floor(v); n != nil {
+		return n.val, true
+	}
+	var zero T
+	return zero, false
+}
+
+// Ceiling returns the least element that does not compare
+// less than v and true, or the zero value and false if every
+// element compares less.
+func (s *Set[T]) Ceiling(v T) (T, bool) {
+	if n := s.t.lowerBound(v); n != nil {
+		return n.val, true
+	}
+	var zero T
+	return zero, false
+}
+
+// Len returns the number of elements in the Set.
+func (s *Set[T]) Len() int {
+	return s.t.size
+}
+
+// Clear removes every element from the Set.
+func (s *Set[T]) Clear() {
+	s.t.root, s.t.size = nil, 0
+}
+
+// Clone returns a copy of the Set that is independent of it.
+// The elements are copied by assignment. Clone takes O(n) time.
+func (s *Set[T]) Clone() *Set[T] {
+	c := &Set[T]{t: s.t}
+	c.t.root = clone(s.t.root, nil)
+	return c
+}
+
+// All returns an iterator over the elements of the Set in
+// ascending order.
+func (s *Set[T]) All() iter.Seq[T] {
+	return s.walk(s.t.bottom(0), 1)
+}
+
+// Backward returns an iterator over the elements of the Set
+// in descending order.
+func (s *Set[T]) Backward() iter.Seq[T] {
+	return s.walk(s.t.bottom(1), 0)
+}
+
+func (s *Set[T]) walk(n *node[T], a int) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for ; n != nil; n = n.walk1(a) {
+			if !yield(n.val) {
+				return
+			}
+		}
+	}
+}
+
+// Range returns an iterator over the elements of the Set from
+// lo to hi inclusive, in ascending order. It is empty if lo is
+// greater than hi.
+func (s *Set[T]) Range(lo, hi T) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for n := s.t.lowerBound(lo); n != nil && s.t.compare(n.val, hi) <= 0; n = n.walk1(1) {
+			if !yield(n.val) {
+				return
+			}
+		}
+	}
+}
+
+// The set operations below walk both Sets in order at once,
+// so they take O(m+n) time, and link the result into a
+// perfectly balanced tree. Both Sets must order their elements
+// the same way; the ordering of s is used, and so is its
+// element wherever both Sets hold elements that compare equal.
+
+// Union returns a new Set holding the elements that are in
+// s, other, or both.
+func (s *Set[T]) Union(other *Set[T]) *Set[T] {
+	return s.merge(other, true, true, true)
+}
+
+// Intersect returns a new Set holding the elements that are
+// in both s and other.
+func (s *Set[T]) Intersect(other *Set[T]) *Set[T] {
+	return s.merge(other, false, true, false)
+}
+
+// Difference returns a new Set holding the elements of s
+// that are not in other.
+func (s *Set[T]) Difference(other *Set[T]) *Set[T] {
+	return s.merge(other, true, false, false)
+}
+
+// IsSubset reports whether every element of s is in other.
+func (s *Set[T]) IsSubset(other *Set[T]) bool {
+	if s.t.size > other.t.size {
+		return false
+	}
+	x, y := s.t.bottom(0), other.t.bottom(0)
+	for x != nil {
+		if y == nil {
+			return false
+		}
+		switch s.t.compare(x.val, y.val) {
+		case -1:
+			return false
+		case 0:
+			x = x.walk1(1)
+		}
+		y = y.walk1(1)
+	}
+	return true
+}
+
+// merge returns a new Set holding the elements found only in
+// s if onlyS is true, in both Sets if both is true, and only
+// in other if onlyOther is true.
+func (s *Set[T]) merge(other *Set[T], onlyS, both, onlyOther bool) *Set[T] {
+	var vals []T
+	x, y := s.t.bottom(0), other.t.bottom(0)
+	for x != nil || y != nil {
+		c := int8(-1)
+		switch {
+		case x == nil:
+			c = 1
+		case y != nil:
+			c = s.t.compare(x.val, y.val)
+		}
+		switch c {
+		case -1:
+			if onlyS {
+				vals = append(vals, x.val)
+			}
+			x = x.walk1(1)
+		case 0:
+			if both {
+				vals = append(vals, x.val)
+			}
+			x, y = x.walk1(1), y.walk1(1)
+		case 1:
+			if onlyOther {
+				vals = append(vals, y.val)
+			}
+			y = y.walk1(1)
+		}
+	}
+	u := NewSet(s.t.cmp)
+	u.t.root, _ = build(vals, nil)
+	u.t.size = len(vals)
+	return u
+}
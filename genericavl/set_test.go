@@ -0,0 +1,223 @@
+package genericavl_test
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/spewspews/avl/genericavl"
+)
+
+func TestSet(t *testing.T) {
+	s := genericavl.NewSet(cmp.Compare[int])
+	ref := make(map[int]bool)
+	for i := 0; i < 5000; i++ {
+		k := rand.Intn(500)
+		switch rand.Intn(3) {
+		case 0:
+			if got, want := s.Add(k), !ref[k]; got != want {
+				t.Fatalf("Add(%d) = %v, want %v", k, got, want)
+			}
+			ref[k] = true
+		case 1:
+			if got, want := s.Remove(k), ref[k]; got != want {
+				t.Fatalf("Remove(%d) = %v, want %v", k, got, want)
+			}
+			delete(ref, k)
+		case 2:
+			if got, want := s.Contains(k), ref[k]; got != want {
+				t.Fatalf("Contains(%d) = %v, want %v", k, got, want)
+			}
+		}
+		if s.Len() != len(ref) {
+			t.Fatalf("Len is %d, want %d", s.Len(), len(ref))
+		}
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var want []int
+	for k := range ref {
+		want = append(want, k)
+	}
+	slices.Sort(want)
+	if got := slices.Collect(s.All()); !slices.Equal(got, want) {
+		t.Errorf("All yielded %v, want %v", got, want)
+	}
+	slices.Reverse(want)
+	if got := slices.Collect(s.Backward()); !slices.Equal(got, want) {
+		t.Errorf("Backward yielded %v, want %v", got, want)
+	}
+}
+
+func TestSetRange(t *testing.T) {
+	s := genericavl.NewSet(cmp.Compare[int])
+	for i := 0; i < 20; i += 2 {
+		s.Add(i)
+	}
+	tests := []struct {
+		lo, hi int
+		want   []int
+	}{
+		{3, 9, []int{4, 6, 8}},
+		{4, 8, []int{4, 6, 8}},
+		{-10, 2, []int{0, 2}},
+		{17, 100, []int{18}},
+		{9, 3, nil},
+	}
+	for _, test := range tests {
+		if got := slices.Collect(s.Range(test.lo, test.hi)); !slices.Equal(got, test.want) {
+			t.Errorf("Range(%d, %d) yielded %v, want %v", test.lo, test.hi, got, test.want)
+		}
+	}
+}
+
+func TestSetClear(t *testing.T) {
+	s := genericavl.NewSet(cmp.Compare[int])
+	for i := 0; i < 10; i++ {
+		s.Add(i)
+	}
+	s.Clear()
+	if s.Len() != 0 || s.Contains(3) {
+		t.Fatalf("after Clear Len is %d", s.Len())
+	}
+	s.Add(3)
+	if got := slices.Collect(s.All()); !slices.Equal(got, []int{3}) {
+		t.Errorf("after Clear and Add(3) the Set holds %v", got)
+	}
+}
+
+func TestSetClone(t *testing.T) {
+	s := genericavl.NewSet(cmp.Compare[int])
+	for i := 0; i < 100; i++ {
+		s.Add(i)
+	}
+	c := s.Clone()
+	for i := 0; i < 100; i += 2 {
+		s.Remove(i)
+	}
+	c.Add(100)
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 50 || c.Len() != 101 || !c.Contains(2) || s.Contains(100) {
+		t.Errorf("changes to a Set and its clone affected each other")
+	}
+}
+
+func TestSetFloor(t *testing.T) {
+	s := genericavl.NewSet(cmp.Compare[int])
+	if v, ok := s.Floor(5); v != 0 || ok {
+		t.Errorf("Floor(5) of an empty Set = %d, %v", v, ok)
+	}
+	for i := 10; i <= 50; i += 10 {
+		s.Add(i)
+	}
+	for _, test := range []struct{ k, floor int }{{10, 10}, {25, 20}, {55, 50}} {
+		if v, ok := s.Floor(test.k); v != test.floor || !ok {
+			t.Errorf("Floor(%d) = %d, %v, want %d, true", test.k, v, ok, test.floor)
+		}
+	}
+	if v, ok := s.Floor(9); ok {
+		t.Errorf("Floor(9) = %d, true, want false", v)
+	}
+}
+
+func TestSetCeiling(t *testing.T) {
+	s := genericavl.NewSet(cmp.Compare[int])
+	if v, ok := s.Ceiling(5); v != 0 || ok {
+		t.Errorf("Ceiling(5) of an empty Set = %d, %v", v, ok)
+	}
+	for i := 10; i <= 50; i += 10 {
+		s.Add(i)
+	}
+	for _, test := range []struct{ k, ceil int }{{5, 10}, {20, 20}, {25, 30}} {
+		if v, ok := s.Ceiling(test.k); v != test.ceil || !ok {
+			t.Errorf("Ceiling(%d) = %d, %v, want %d, true", test.k, v, ok, test.ceil)
+		}
+	}
+	if v, ok := s.Ceiling(51); ok {
+		t.Errorf("Ceiling(51) = %d, true, want false", v)
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	a := genericavl.NewSet(cmp.Compare[int])
+	b := genericavl.NewSet(cmp.Compare[int])
+	for _, v := range []int{1, 2, 3, 5, 8} {
+		a.Add(v)
+	}
+	for _, v := range []int{2, 3, 4, 8, 9} {
+		b.Add(v)
+	}
+	tests := []struct {
+		name string
+		s    *genericavl.Set[int]
+		want []int
+	}{
+		{"Union", a.Union(b), []int{1, 2, 3, 4, 5, 8, 9}},
+		{"Intersect", a.Intersect(b), []int{2, 3, 8}},
+		{"Difference", a.Difference(b), []int{1, 5}},
+		{"reverse Difference", b.Difference(a), []int{4, 9}},
+	}
+	for _, test := range tests {
+		if err := test.s.Validate(); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if got := slices.Collect(test.s.All()); !slices.Equal(got, test.want) {
+			t.Errorf("%s = %v, want %v", test.name, got, test.want)
+		}
+	}
+	if a.IsSubset(b) || !a.Intersect(b).IsSubset(b) || !a.IsSubset(a.Union(b)) {
+		t.Error("IsSubset is wrong")
+	}
+}
+
+// FuzzSetAlgebra builds two sets from the bytes of its
+// inputs and checks the set operations against maps.
+func FuzzSetAlgebra(f *testing.F) {
+	f.Add([]byte{1, 2, 3}, []byte{2, 3, 4})
+	f.Add([]byte{}, []byte{7})
+	f.Add([]byte{5, 5, 1}, []byte{1, 5})
+	f.Fuzz(func(t *testing.T, x, y []byte) {
+		a := genericavl.NewSet(cmp.Compare[byte])
+		b := genericavl.NewSet(cmp.Compare[byte])
+		inA := make(map[byte]bool)
+		inB := make(map[byte]bool)
+		for _, v := range x {
+			a.Add(v)
+			inA[v] = true
+		}
+		for _, v := range y {
+			b.Add(v)
+			inB[v] = true
+		}
+		check := func(name string, s *genericavl.Set[byte], in func(byte) bool) {
+			if err := s.Validate(); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			var want []byte
+			for v := 0; v < 256; v++ {
+				if in(byte(v)) {
+					want = append(want, byte(v))
+				}
+			}
+			if got := slices.Collect(s.All()); !slices.Equal(got, want) {
+				t.Fatalf("%s = %v, want %v", name, got, want)
+			}
+		}
+		check("Union", a.Union(b), func(v byte) bool { return inA[v] || inB[v] })
+		check("Intersect", a.Intersect(b), func(v byte) bool { return inA[v] && inB[v] })
+		check("Difference", a.Difference(b), func(v byte) bool { return inA[v] && !inB[v] })
+
+		subset := true
+		for v := range inA {
+			subset = subset && inB[v]
+		}
+		if got := a.IsSubset(b); got != subset {
+			t.Fatalf("IsSubset = %v, want %v", got, subset)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package genericavl
+
+import (
+	"iter"
+	"sync"
+)
+
+// ShardedMap is an ordered map that is safe for concurrent use.
+// It spreads its keys over several Maps by a hash of the key,
+// each guarded by its own lock, so that goroutines working on
+// keys in different shards do not contend. Operations on single
+// keys lock one shard. Len and Range lock every shard in turn,
+// so they do not observe a consistent snapshot of the whole map
+// while other goroutines modify it.
+type ShardedMap[K, V any] struct {
+	shards []shard[K, V]
+	hash   func(K) uint64
+	cmp    func(a, b K) int
+}
+
+type shard[K, V any] struct {
+	mu sync.RWMutex
+	m  *Map[K, V]
+}
+
+// NewShardedMap returns an empty ShardedMap with n shards whose
+// keys are ordered by cmp, as for New. Keys that compare
+// equal must have equal hashes.
+func NewShardedMap[K, V any](cmp func(a, b K) int, hash func(K) uint64, n int) *ShardedMap[K, V] {
+	if n < 1 {
+		n = 1
+	}
+	s := &ShardedMap[K, V]{
+		shards: make([]shard[K, V], n),
+		hash:   hash,
+		cmp:    cmp,
+	}
+	for i := range s.shards {
+		s.shards[i].m = New[K, V](cmp)
+	}
+	return s
+}
+
+func (s *ShardedMap[K, V]) shard(key K) *shard[K, V] {
+	return &s.shards[s.hash(key)%uint64(len(s.shards))]
+}
+
+// Set maps key to val, replacing any previous mapping of key.
+func (s *ShardedMap[K, V]) Set(key K, val V) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	sh.m.Set(key, val)
+	sh.mu.Unlock()
+}
+
+// Get returns the value mapped to key and true, or the zero
+// value and false if key is not in the ShardedMap.
+func (s *ShardedMap[K, V]) Get(key K) (V, bool) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	return sh.m.Get(key)
+}
+
+// Delete removes the mapping of key and reports whether
+// there was one.
+func (s *ShardedMap[K, V]) Delete(key K) bool {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.m.Delete(key)
+}
+
+// Len returns the number of keys in the ShardedMap.
+func (s *ShardedMap[K, V]) Len() int {
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		n += sh.m.Len()
+		sh.mu.RUnlock()
+	}
+	return n
+}
+
+// Range returns an iterator over the key-value pairs of the
+// ShardedMap with keys from lo to hi inclusive, in ascending
+// order of key. Since the keys are spread over the shards by
+// hash, every shard holds part of any range. Range copies the
+// m pairs in the range out of each shard under its read lock,
+// using O(m) space, and then merges them by comparing the next
+// key of each of the n shards, O(m·n) comparisons in all.
+func (s *ShardedMap[K, V]) Range(lo, hi K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		runs := make([][]entry[K, V], len(s.shards))
+		for i := range s.shards {
+			sh := &s.shards[i]
+			sh.mu.RLock()
+			for k, v := range sh.m.Range(lo, hi) {
+				runs[i] = append(runs[i], entry[K, V]{k, v})
+			}
+			sh.mu.RUnlock()
+		}
+		for {
+			min := -1
+			for i, run := range runs {
+				if len(run) > 0 && (min < 0 || s.cmp(run[0].key, runs[min][0].key) < 0) {
+					min = i
+				}
+			}
+			if min < 0 {
+				return
+			}
+			e := runs[min][0]
+			runs[min] = runs[min][1:]
+			if !yield(e.key, e.val) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package avl
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// join links l, k, and r, whose elements must be in that order,
+// into one balanced tree and returns its root and height. The
+// heights of l and r are hl and hr. The node k is linked between the two
+// in O(|hl-hr|) time by walking down the inner spine of the
+// taller tree to a subtree of about the height of the shorter
+// one and rebalancing back up as for an insertion.
+func join(l, k, r *Node, hl, hr int) (*Node, int) {
+	k.p = nil
+	if hl-hr <= 1 && hr-hl <= 1 {
+		k.c[0], k.c[1] = l, r
+		k.b = int8(hr - hl)
+		for _, c := range k.c {
+			if c != nil {
+				c.p = k
+			}
+		}
+		k.fixSize()
+		if hl > hr {
+			return k, hl + 1
+		}
+		return k, hr + 1
+	}
+
+	// Descend the inner spine of the taller tree in direction a.
+	tall, short, ht, hs := l, r, hl, hr
+	var a int = 1
+	if hr > hl {
+		tall, short, ht, hs = r, l, hr, hl
+		a = 0
+	}
+	c := int8(2*a - 1)
+
+	root := tall
+	qp := &root
+	var path []**Node
+	var p *Node
+	h := ht
+	for h > hs+1 {
+		path = append(path, qp)
+		p = *qp
+		if p.b == -c {
+			h -= 2
+		} else {
+			h--
+		}
+		qp = &p.c[a]
+	}
+
+	// The subtree at *qp has height h, which is hs or hs+1.
+	// Replacing it with k, which has it and short as children,
+	// makes the subtree exactly one taller.
+	s := *qp
+	k.c[a^1], k.c[a] = s, short
+	k.b = c * int8(hs-h)
+	if s != nil {
+		s.p = k
+	}
+	if short != nil {
+		short.p = k
+	}
+	k.p = p
+	k.fixSize()
+	*qp = k
+
+	grew := true
+	for i := len(path) - 1; i >= 0; i-- {
+		(*path[i]).fixSize()
+		if grew {
+			grew = insertFix(c, path[i])
+		}
+	}
+	root.p = nil
+	if grew {
+		return root, ht + 1
+	}
+	return root, ht
+}
+
+// height returns the height of the subtree rooted at n by
+// following the balance factors down its taller side.
+func height(n *Node) int {
+	h := 0
+	for ; n != nil; h++ {
+		if n.b < 0 {
+			n = n.c[0]
+		} else {
+			n = n.c[1]
+		}
+	}
+	return h
+}
+
+// SplitAt moves the k smallest elements of t into one new
+// Tree and the rest into another and returns them. Both are
+// balanced and share the Compare method and Options of t,
+// which is left empty. If k is out of range one of the
+// results is empty. SplitAt takes O(log n) time.
+func (t *Tree) SplitAt(k int) (*Tree, *Tree) {
+	l, r := t.empty(), t.empty()
+	l.root, _, r.root, _ = splitAt(t.root, t.Height(), k)
+	l.size = sizeOf(l.root)
+	r.size = sizeOf(r.root)
+	l.resetExtremes()
+	r.resetExtremes()
+	t.root, t.size = nil, 0
+	t.min, t.max = nil, nil
+	if t.cache != nil {
+		t.cache = newLookupCache(t.cacheSize)
+	}
+	return l, r
+}
+
+// empty returns an empty Tree configured like t.
+func (t *Tree) empty() *Tree {
+	u := *t
+	u.root, u.size, u.deleted = nil, 0, 0
+	u.min, u.max = nil, nil
+	if t.cache != nil {
+		u.cache = newLookupCache(t.cacheSize)
+	}
+	return &u
+}
+
+// splitAt splits the subtree rooted at n, of height h, into
+// the first k nodes and the rest and returns their roots and
+// heights.
+func splitAt(n *Node, h, k int) (*Node, int, *Node, int) {
+	if n == nil {
+		return nil, 0, nil, 0
+	}
+	hl, hr := h-1, h-1
+	switch {
+	case n.b < 0:
+		hr--
+	case n.b > 0:
+		hl--
+	}
+	l, r := n.c[0], n.c[1]
+	if k <= sizeOf(l) {
+		ll, hll, lr, hlr := splitAt(l, hl, k)
+		r, hr = join(lr, n, r, hlr, hr)
+		if ll != nil {
+			ll.p = nil
+		}
+		return ll, hll, r, hr
+	}
+	rl, hrl, rr, hrr := splitAt(r, hr, k-sizeOf(l)-1)
+	l, hl = join(l, n, rl, hl, hrl)
+	if rr != nil {
+		rr.p = nil
+	}
+	return l, hl, rr, hrr
+}
+
+func (t *Tree) appendSorted(in []reflect.Value) []reflect.Value {
+	vals := in[0]
+	nvals := vals.Len()
+	if nvals == 0 {
+		return []reflect.Value{reflect.Zero(errorType)}
+	}
+
+	if err := t.checkAppend("AppendSorted", vals); err != nil {
+		return []reflect.Value{reflect.ValueOf(&err).Elem()}
+	}
+	nodes := make([]*Node, nvals)
+	for i := range nodes {
+		nodes[i] = &Node{val: t.stored(vals.Index(i))}
+	}
+	t.appendNodes(nodes)
+	return []reflect.Value{reflect.Zero(errorType)}
+}
+
+// checkAppend returns an error naming the first element of
+// vals that does not follow the one before it, or the maximum
+// of the tree for the first element.
+func (t *Tree) checkAppend(name string, vals reflect.Value) error {
+	var prev reflect.Value
+	if max := t.Max(); max != nil {
+		prev = max.val
+	}
+	return t.checkSorted(name, vals, prev)
+}
+
+// checkSorted returns an error naming the first element of
+// vals that does not follow the one before it, or prev for the
+// first element if prev is valid.
+func (t *Tree) checkSorted(name string, vals, prev reflect.Value) error {
+	for i := 0; i < vals.Len(); i++ {
+		v := vals.Index(i)
+		if t.guard != nil {
+			t.guard(v)
+		}
+		if prev.IsValid() && !t.follows(v, prev) {
+			return fmt.Errorf("avl: %s element %d, %v, does not follow %v", name, i, v, prev)
+		}
+		prev = v
+	}
+	return nil
+}
+
+func (t *Tree) parallelBuild(in []reflect.Value) []reflect.Value {
+	vals, workers := in[0], int(in[1].Int())
+	nvals := vals.Len()
+	if nvals == 0 {
+		return []reflect.Value{reflect.Zero(errorType)}
+	}
+
+	// Compare shares its argument buffer, so the
+	// order is checked by this goroutine alone.
+	if err := t.checkAppend("ParallelBuild", vals); err != nil {
+		return []reflect.Value{reflect.ValueOf(&err).Elem()}
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	nodes := make([]*Node, nvals)
+	var wg sync.WaitGroup
+	seg := (nvals + workers - 1) / workers
+	for lo := 0; lo < nvals; lo += seg {
+		hi := lo + seg
+		if hi > nvals {
+			hi = nvals
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			for i := lo; i < hi; i++ {
+				nodes[i] = &Node{val: t.stored(vals.Index(i))}
+			}
+		}(lo, hi)
+	}
+	wg.Wait()
+
+	// Each level of buildParallel halves the nodes
+	// and doubles the goroutines linking them.
+	depth := 0
+	for 1<<depth < workers {
+		depth++
+	}
+	r, hr := buildParallel(nodes[1:], nil, depth)
+	t.root, _ = join(t.root, nodes[0], r, t.Height(), hr)
+	t.size += nvals
+	t.resetExtremes()
+	return []reflect.Value{reflect.Zero(errorType)}
+}
+
+// buildParallel is like build but links the left subtrees of
+// the top depth levels in new goroutines.
+func buildParallel(nodes []*Node, p *Node, depth int) (*Node, int) {
+	if depth == 0 || len(nodes) < 2 {
+		return build(nodes, p)
+	}
+
+	m := len(nodes) / 2
+	n := nodes[m]
+	n.p = p
+	n.size = len(nodes)
+	var hl, hr int
+	done := make(chan struct{})
+	go func() {
+		n.c[0], hl = buildParallel(nodes[:m], n, depth-1)
+		close(done)
+	}()
+	n.c[1], hr = buildParallel(nodes[m+1:], n, depth-1)
+	<-done
+	n.b = int8(hr - hl)
+	if hl > hr {
+		return n, hl + 1
+	}
+	return n, hr + 1
+}
+
+// appendNodes links the ordered nodes in after the maximum
+// of the tree as a balanced subtree.
+func (t *Tree) appendNodes(nodes []*Node) {
+	if len(nodes) == 0 {
+		return
+	}
+	r, hr := build(nodes[1:], nil)
+	t.root, _ = join(t.root, nodes[0], r, t.Height(), hr)
+	t.size += len(nodes)
+	t.resetExtremes()
+}
+
+// seqChunk is the most elements insertSeq collects
+// before linking them into the tree.
+const seqChunk = 256
+
+func (t *Tree) insertSeq(in []reflect.Value) []reflect.Value {
+	seq := in[0]
+	var last reflect.Value
+	if max := t.Max(); max != nil {
+		last = max.val
+	}
+	run := make([]*Node, 0, seqChunk)
+	// The collected elements are linked in even if Compare or
+	// a method panics, so that they are not silently dropped.
+	defer func() {
+		t.appendNodes(run)
+	}()
+	yield := reflect.MakeFunc(seq.Type().In(0), func(in []reflect.Value) []reflect.Value {
+		v := in[0]
+		if t.guard != nil {
+			t.guard(v)
+		}
+		if !last.IsValid() || t.follows(v, last) {
+			run = append(run, &Node{val: t.stored(v)})
+			if len(run) == seqChunk {
+				t.appendNodes(run)
+				run = run[:0]
+			}
+			last = v
+		} else {
+			t.appendNodes(run)
+			run = run[:0]
+			t.insert1(t.stored(v), nil, &t.root, nil)
+		}
+		return []reflect.Value{reflect.ValueOf(true)}
+	})
+	seq.Call([]reflect.Value{yield})
+	return nil
+}
+
+// follows reports whether v may be placed after prev
+// without violating the order of the tree.
+func (t *Tree) follows(v, prev reflect.Value) bool {
+	c := t.cmp(prev, v)
+	return c < 0 || c == 0 && t.multiset
+}
+
+// concat joins l and r, of heights hl and hr, whose elements
+// must be in that order, and returns the root and height of
+// the result.
+func concat(l *Node, hl int, r *Node, hr int) (*Node, int) {
+	if r == nil {
+		return l, hl
+	}
+	if l == nil {
+		return r, hr
+	}
+	var k *Node
+	if deleteMin(&r, &k) {
+		hr--
+	}
+	return join(l, k, r, hl, hr)
+}
+
+// DeleteRankRange deletes the elements of 0-based ranks a
+// through b-1 and returns how many were deleted. The range
+// is clipped to the elements in the Tree. It splits out the
+// range and joins the rest, so apart from visiting each deleted
+// Node to mark it deleted it takes O(log n) time.
+func (t *Tree) DeleteRankRange(a, b int) int {
+	if a < 0 {
+		a = 0
+	}
+	if b > t.size {
+		b = t.size
+	}
+	if a >= b {
+		return 0
+	}
+
+	l, hl, r, hr := splitAt(t.root, t.Height(), b)
+	l, hl, m, _ := splitAt(l, hl, a)
+	t.root, _ = concat(l, hl, r, hr)
+	t.size -= b - a
+	t.deleted += b - a
+	t.resetExtremes()
+	t.discard(m)
+	t.maybeRebuild()
+	return b - a
+}
+
+// discard marks every node of the subtree rooted at n deleted,
+// passing their elements to OnEvict in ascending order.
+func (t *Tree) discard(n *Node) {
+	if n == nil {
+		return
+	}
+	l, r := n.c[0], n.c[1]
+	t.discard(l)
+	if t.onEvict != nil {
+		t.onEvict(n.val)
+	}
+	n.unlink()
+	t.discard(r)
+}
@@ -0,0 +1,91 @@
+package avl
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+)
+
+// MemoizeCompare returns an Option that caches the results of
+// up to size distinct calls of Compare, evicting the least
+// recently used result when the cache is full. Looking up a
+// cached result converts both elements to interfaces and hashes
+// them, so this only pays off when Compare is much more
+// expensive than that, for example when it collates long
+// strings, and when the same pairs of elements are compared
+// repeatedly, as in many lookups of the same keys. Compare must
+// be a pure function of its arguments. The element type must
+// be comparable or Make returns an error. If it is or contains
+// an interface type, comparisons of values that are not
+// comparable, such as slices, are not memoized, and neither
+// are comparisons of values that are not equal to themselves,
+// such as NaNs.
+func MemoizeCompare(size int) Option {
+	return func(t *Tree) {
+		t.memoSize = size
+	}
+}
+
+func (t *Tree) memoize() error {
+	if !t.elemType.Comparable() {
+		return fmt.Errorf("MemoizeCompare requires a comparable element type, not %v", t.elemType)
+	}
+	m := &cmpMemo{
+		cmp:     t.cmp,
+		size:    t.memoSize,
+		lru:     list.New(),
+		m:       make(map[[2]interface{}]*list.Element),
+		dynamic: hasInterface(t.elemType),
+	}
+	t.memo = m
+	t.cmp = m.compare
+	return nil
+}
+
+// cmpMemo is a least recently used cache of comparison results.
+type cmpMemo struct {
+	cmp  func(a, b reflect.Value) int8
+	size int
+	lru  *list.List // of *memoEntry, most recently used first
+	m    map[[2]interface{}]*list.Element
+
+	// dynamic is set if the elements may hold interface
+	// values that cannot be hashed.
+	dynamic bool
+}
+
+type memoEntry struct {
+	key [2]interface{}
+	c   int8
+}
+
+func (m *cmpMemo) compare(a, b reflect.Value) int8 {
+	if m.dynamic && !(a.Comparable() && b.Comparable()) {
+		return m.cmp(a, b)
+	}
+	key := [2]interface{}{a.Interface(), b.Interface()}
+	if key != key {
+		// A key holding a NaN never matches an entry, not
+		// even its own, so it could never be found or evicted.
+		return m.cmp(a, b)
+	}
+	if e, ok := m.m[key]; ok {
+		m.lru.MoveToFront(e)
+		return e.Value.(*memoEntry).c
+	}
+
+	c := m.cmp(a, b)
+	if m.lru.Len() < m.size {
+		m.m[key] = m.lru.PushFront(&memoEntry{key, c})
+		return c
+	}
+
+	// Reuse the least recently used entry.
+	e := m.lru.Back()
+	me := e.Value.(*memoEntry)
+	delete(m.m, me.key)
+	me.key, me.c = key, c
+	m.m[key] = e
+	m.lru.MoveToFront(e)
+	return c
+}
@@ -0,0 +1,17 @@
+package avl
+
+import "fmt"
+
+// CheckSortedUnique returns nil if each of values compares
+// greater than the one before it according to cmp, which is
+// what in-order walks of a Tree without the Multiset option
+// produce and what AppendSorted requires. Otherwise it returns
+// an error naming the index of the first value that does not.
+func CheckSortedUnique[T any](values []T, cmp func(a, b T) int) error {
+	for i := 1; i < len(values); i++ {
+		if cmp(values[i-1], values[i]) >= 0 {
+			return fmt.Errorf("avl: value %d, %v, does not follow %v", i, values[i], values[i-1])
+		}
+	}
+	return nil
+}